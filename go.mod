@@ -1,9 +1,8 @@
-module go_nes
+module github.com/ad-sho-loko/goones
 
-go 1.12
+go 1.13
 
 require (
-	github.com/ad-sho-loko/goones v0.0.0-20190817094426-e9d6438c9a16
 	github.com/go-gl/gl v0.0.0-20190320180904-bf2b1f2f34d7 // indirect
 	github.com/go-gl/glfw v0.0.0-20190409004039-e6da0acd62b1 // indirect
 )
@@ -0,0 +1,64 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ad-sho-loko/goones/nes"
+	"github.com/ad-sho-loko/goones/ui"
+)
+
+var (
+	bindings = flag.String("bindings", "", "key bindings file (default: goones/bindings.json in the user config dir)")
+	ffSpeed  = flag.Float64("fastforward", ui.DefaultFastForward, "speed while the fast_forward hotkey is held")
+	uncapped = flag.Bool("uncapped", false, "run as fast as possible without the frame limiter, e.g. for benchmarking")
+	shotDir  = flag.String("screenshotdir", ".", "directory where the screenshot hotkey saves the `.png` files")
+)
+
+// keyBindings are loaded by devicePorts before the devices are connected.
+var keyBindings *ui.Bindings
+
+func loadBindings() (*ui.Bindings, error){
+	path := *bindings
+	if path == "" {
+		p, err := ui.DefaultBindingsPath()
+		if err != nil {
+			// no config dir, so use the defaults
+			return ui.LoadBindings("")
+		}
+		path = p
+	}
+	return ui.LoadBindings(path)
+}
+
+// devicePorts returns the devices of the ports in the bindings file, which are overridden by the options.
+func devicePorts() (map[string]string, error){
+	b, err := loadBindings()
+	if err != nil{
+		return nil, err
+	}
+	keyBindings = b
+
+	ports := b.Ports()
+	for port, name := range flagPorts() {
+		ports[port] = name
+	}
+	return ports, nil
+}
+
+// runGui runs the console in the window until it is closed.
+func runGui(n *nes.Nes) error{
+	if *ffSpeed <= 0 {
+		return fmt.Errorf("fastforward must be more than 0")
+	}
+	ui.RunUi(n, keyBindings, ui.Options{
+		FastForward:   *ffSpeed,
+		IsUncapped:    *uncapped,
+		RomName:       romName(),
+		ScreenshotDir: *shotDir,
+		Screenshot:    screenshotOptions(),
+	})
+	return nil
+}
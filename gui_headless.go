@@ -0,0 +1,19 @@
+//go:build headless
+// +build headless
+
+package main
+
+import (
+	"errors"
+	"github.com/ad-sho-loko/goones/nes"
+)
+
+// devicePorts returns the devices of the options, because the bindings file is for the window.
+func devicePorts() (map[string]string, error){
+	return flagPorts(), nil
+}
+
+// runGui is not available in the headless build, which links neither glfw nor OpenGL.
+func runGui(n *nes.Nes) error{
+	return errors.New("this goones is built without the window (headless tag), so run it with -headless")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ad-sho-loko/goones/nes"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	headless   = flag.Bool("headless", false, "run without the window, e.g. on CI servers without a display")
+	frames     = flag.Int("frames", 0, "frames to run in headless mode (default: to the end of the movie)")
+	input      = flag.String("input", "", "play the `.fm2` movie as the input (same as -play)")
+	screenshot = flag.String("screenshot", "", "save the last frame of headless mode into the `.png` file")
+	dumpRam    = flag.String("dump-ram", "", "save WRAM ($0000 - $07FF) at the end of headless mode into the `file`")
+)
+
+// moviePlayPath returns the movie given by -play or -input.
+func moviePlayPath() string{
+	if *play != "" {
+		return *play
+	}
+	return *input
+}
+
+// runHeadless runs the frames without the window and saves the results.
+// A desync of the movie is an error, after the results are saved.
+func runHeadless(n *nes.Nes) error{
+	if *frames <= 0 && !n.IsMoviePlaying() {
+		return errors.New("-frames or a movie to play is needed in headless mode")
+	}
+
+	if err := n.Init(); err != nil {
+		return err
+	}
+	count := 0
+	for (*frames > 0 && count < *frames) || (*frames <= 0 && n.IsMoviePlaying()) {
+		n.Run()
+		count++
+	}
+	fmt.Printf("%d frames\n", count)
+
+	if *screenshot != "" {
+		if err := saveScreenshot(n, *screenshot); err != nil {
+			return err
+		}
+	}
+	if *dumpRam != "" {
+		if err := ioutil.WriteFile(*dumpRam, n.Ram(), 0644); err != nil {
+			return err
+		}
+	}
+
+	if frame, ok := n.MovieDesync(); ok {
+		return fmt.Errorf("movie desynced at frame %d", frame)
+	}
+	return nil
+}
+
+func saveScreenshot(n *nes.Nes, path string) error{
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := n.WriteScreenshot(f, romName(), screenshotOptions()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,29 +1,294 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/ad-sho-loko/goones/nes"
-	"github.com/ad-sho-loko/goones/ui"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	palette    = flag.String("palette", "", "`.pal` file (64 or 512 colors), or \"ntsc\" to generate the palette")
+	hue        = flag.Float64("hue", nes.DefaultNtscParams.Hue, "hue of the ntsc palette (degree)")
+	saturation = flag.Float64("saturation", nes.DefaultNtscParams.Saturation, "saturation of the ntsc palette")
+	contrast   = flag.Float64("contrast", nes.DefaultNtscParams.Contrast, "contrast of the ntsc palette")
+	brightness = flag.Float64("brightness", nes.DefaultNtscParams.Brightness, "brightness of the ntsc palette")
+	gamma      = flag.Float64("gamma", nes.DefaultNtscParams.Gamma, "gamma of the reference display for the ntsc palette")
+	region     = flag.String("region", "auto", "region of the console: auto, ntsc, pal or dendy")
+	romDb      = flag.String("romdb", "", "rom database of the regions for \"auto\" (lines of \"<md5 of PRG-ROM and CHR-ROM> <region>\")")
+	ntsc       = flag.Bool("ntsc", false, "emulate the artifacts of ntsc composite video (uses the ntsc palette options)")
+	port1      = flag.String("port1", "auto", "device on port 1: auto, controller, zapper, vaus, powerpad or none")
+	port2      = flag.String("port2", "auto", "device on port 2: auto, controller, zapper, vaus, powerpad or none")
+	fourPlayer = flag.String("4p", "auto", "four player adapter on both ports: auto, fourscore, famicom or none")
+	record     = flag.String("record", "", "record the input into the `.fm2` movie from power-on")
+	play       = flag.String("play", "", "play the `.fm2` movie from power-on")
+	readWrite  = flag.Bool("readwrite", false, "play the movie in read-write mode; pushing any button records from there")
+	expansion  = flag.String("expansion", "auto", "device on the famicom expansion port: auto, keyboard, vaus or none")
+	ramPattern = flag.String("ram", "zeros", "RAM at power-on: zeros, ff, alternating or random")
+	crop       = flag.Bool("crop", false, "crop the overscan lines of screenshots")
+	aspect     = flag.Bool("aspect", false, "scale screenshots by the pixel aspect ratio of the region")
+	scale      = flag.Int("scale", 1, "scale of screenshots")
+	ramSeed    = flag.Int64("ramseed", 0, "seed of the random RAM (default: from the time, which is printed)")
 )
 
 func usage(){
 	fmt.Println("no rom files specified or found")
+	fmt.Println("usage: goones [run] [options] [.nes-file]")
+	flag.PrintDefaults()
+}
+
+func ntscParams() nes.NtscParams{
+	return nes.NtscParams{
+		Hue:        *hue,
+		Saturation: *saturation,
+		Contrast:   *contrast,
+		Brightness: *brightness,
+		Gamma:      *gamma,
+	}
+}
+
+func loadPalette() (*nes.Palette, error){
+	if *palette == "ntsc" {
+		return nes.GeneratePalette(ntscParams()), nil
+	}
+	return nes.LoadPalette(*palette)
+}
+
+func inputDevice(name string) (nes.InputDevice, error){
+	switch name {
+	case "controller":
+		return nes.NewController(), nil
+	case "zapper":
+		return nes.NewZapper(), nil
+	case "vaus":
+		return nes.NewVaus(), nil
+	case "powerpad":
+		return nes.NewPowerPad(), nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown input device: %s", name)
+}
+
+func expansionDevice(name string) (nes.ExpansionDevice, error){
+	switch name {
+	case "keyboard":
+		return nes.NewFamilyKeyboard(), nil
+	case "vaus":
+		return nes.NewVaus(), nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown expansion device: %s", name)
+}
+
+// portFlags are the options of the devices by their names, which are also the ports in the bindings file.
+var portFlags = map[string]*string{
+	"port1":     port1,
+	"port2":     port2,
+	"4p":        fourPlayer,
+	"expansion": expansion,
+}
+
+// flagPorts returns the devices of the ports which are given by the options.
+func flagPorts() map[string]string{
+	ports := map[string]string{}
+	flag.Visit(func(f *flag.Flag){
+		if name, ok := portFlags[f.Name]; ok {
+			ports[f.Name] = *name
+		}
+	})
+	return ports
+}
+
+// connectDevices overrides the devices which the cassette expects ("auto").
+// The ports which are absent are "auto".
+func connectDevices(n *nes.Nes, ports map[string]string) error{
+	device := func(port string) string{
+		if name, ok := ports[port]; ok {
+			return name
+		}
+		return "auto"
+	}
+
+	switch adapter := device("4p"); adapter {
+	case "fourscore":
+		n.ConnectFourPlayerAdapter(nes.NewFourScore())
+	case "famicom":
+		n.ConnectFourPlayerAdapter(nes.NewFamicomFourPlayerAdapter())
+	case "none":
+		n.ConnectInputDevice(nes.Port1, nes.NewController())
+		n.ConnectInputDevice(nes.Port2, nes.NewController())
+	case "auto":
+	default:
+		return fmt.Errorf("unknown four player adapter: %s", adapter)
+	}
+
+	for port, name := range []string{device("port1"), device("port2")} {
+		if name == "auto" {
+			continue
+		}
+		d, err := inputDevice(name)
+		if err != nil{
+			return err
+		}
+		n.ConnectInputDevice(port, d)
+	}
+
+	if name := device("expansion"); name != "auto" {
+		d, err := expansionDevice(name)
+		if err != nil{
+			return err
+		}
+		n.ConnectExpansionDevice(d)
+	}
+	return nil
+}
+
+// setPowerOnRam fills RAM with the pattern. The seed of the random RAM is printed to reproduce it.
+func setPowerOnRam(n *nes.Nes) error{
+	pattern, err := nes.ParseRamPattern(*ramPattern)
+	if err != nil {
+		return err
+	}
+	seed := *ramSeed
+	if pattern == nes.RamRandom && seed == 0 {
+		seed = time.Now().UnixNano()
+		fmt.Printf("ram seed: %d\n", seed)
+	}
+	n.SetPowerOnRam(nes.PowerOnRam{Pattern: pattern, Seed: seed})
+	return nil
+}
+
+// romName is the name of the rom file without the extension, e.g. "mario" of "roms/mario.nes".
+func romName() string{
+	return strings.TrimSuffix(filepath.Base(flag.Arg(0)), filepath.Ext(flag.Arg(0)))
+}
+
+func screenshotOptions() nes.ScreenshotOptions{
+	return nes.ScreenshotOptions{
+		IsCropped:         *crop,
+		IsAspectCorrected: *aspect,
+		Scale:             *scale,
+	}
+}
+
+// startMovie starts recording or playing the movie, and returns the file to save it at the end.
+func startMovie(n *nes.Nes) (string, error){
+	if *record != "" {
+		m, err := n.NewMovie(romName())
+		if err != nil {
+			return "", err
+		}
+		return *record, n.RecordMovie(m)
+	}
+
+	if path := moviePlayPath(); path != "" {
+		m, err := nes.LoadMovie(path)
+		if err != nil {
+			return "", err
+		}
+		mode := nes.MovieReadOnly
+		if *readWrite {
+			mode = nes.MovieReadWrite
+		}
+		return path, n.PlayMovie(m, mode)
+	}
+	return "", nil
 }
 
 func main(){
+	flag.Usage = usage
+	// "run" is optional, e.g. goones run -headless -frames 600 rom.nes
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
-	if len(os.Args) < 2{
+	if flag.NArg() < 1{
 		usage()
 		os.Exit(1)
 	}
 
-	m, err:= nes.NewCassette(os.Args[1])
+	if *romDb != "" {
+		if err := nes.LoadRegionDatabase(*romDb); err != nil{
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	m, err:= nes.NewCassette(flag.Arg(0))
 	if err != nil{
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
 	n := nes.NewNes(m)
-	ui.RunUi(n)
+
+	if *region != "auto" {
+		r, err := nes.ParseRegion(*region)
+		if err != nil{
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		n.SetRegion(r)
+	}
+
+	if err := setPowerOnRam(n); err != nil{
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ports, err := devicePorts()
+	if err != nil{
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := connectDevices(n, ports); err != nil{
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *palette != "" {
+		p, err := loadPalette()
+		if err != nil{
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		n.SetPalette(p)
+	}
+
+	if *ntsc {
+		params := ntscParams()
+		n.SetNtscFilter(&params)
+	}
+
+	moviePath, err := startMovie(n)
+	if err != nil{
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *headless {
+		err = runHeadless(n)
+	} else {
+		err = runGui(n)
+	}
+	if err != nil{
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// save the movie if it is recorded, including rerecords in read-write mode.
+	isRecorded := n.IsMovieRecording()
+	if movie := n.StopMovie(); movie != nil && isRecorded {
+		if err := movie.Save(moviePath); err != nil{
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 }
@@ -4,14 +4,15 @@ type Bus struct{
 	wram Mem
 	cpu *Cpu
 	ppu *Ppu
-	controller *Controller
-	prgRom []byte
+	ports [2]InputDevice // devices on $4016 and $4017
+	expansion ExpansionDevice
+	mapper Mapper
 }
 
-func NewBus(wram Mem, prgRom []byte) *Bus{
+func NewBus(wram Mem, mapper Mapper) *Bus{
 	return &Bus{
 		wram: wram,
-		prgRom:prgRom,
+		mapper:mapper,
 	}
 }
 
@@ -20,24 +21,17 @@ func (b *Bus) Load(addr word) byte{
 		return b.wram.load(addr)
 	} else if addr < 0x2000 {
 		return b.wram.load(addr % 0x0800)
-	} else if addr == 0x2002 {
-		return b.ppu.readPpuStatus()
-	} else if addr == 0x2004 {
-		return b.ppu.readOamData()
-	} else if addr == 0x2007{
-		return b.ppu.readPpuData()
-	} else if addr < 0x4000{
-		// mirror
-		b.Load(addr % 8)
-	} else if addr == 0x4016{
-		return b.controller.read()
+	} else if addr < 0x4000 {
+		// 0x2008 - 0x3FFF are mirrors of 0x2000 - 0x2007
+		b.syncPpu()
+		return b.loadPpu(0x2000 + addr % 8)
+	} else if addr == 0x4016 || addr == 0x4017 {
+		return b.loadPort(addr)
 	} else if addr < 0x4020 {
 		// I/Oポート
 		return 0x00
-	} else if addr >= 0x6000 && addr < 0x8000{
-		return b.prgRom[addr - 0x6000]
-	} else if addr >= 0x8000 {
-		return b.prgRom[addr - 0x8000]
+	} else if addr >= 0x6000 {
+		return b.mapper.loadPrg(addr)
 	}
 
 	abort("[Load] Not implementd address 0x%x", addr)
@@ -65,7 +59,73 @@ func (b *Bus) Store(addr word, v byte){
 	} else if addr < 0x2000 {
 		// mirror
 		b.wram.store(addr % 0x0800, v)
-	} else if addr == 0x2000 {
+	} else if addr < 0x4000 {
+		// 0x2008 - 0x3FFF are mirrors of 0x2000 - 0x2007
+		b.syncPpu()
+		b.storePpu(0x2000 + addr % 8, v)
+	} else if addr == 0x4014{
+		// DMA
+		b.dmaTransfer(v)
+	} else if addr == 0x4016{
+		// OUT0-OUT2 are connected to both ports.
+		for _, d := range b.ports {
+			if d != nil {
+				d.Write(v)
+			}
+		}
+		if b.expansion != nil {
+			b.expansion.Write(v)
+		}
+	} else if addr < 0x4020{
+		// sound etc..
+	} else if addr >= 0x6000 {
+		if m, ok := b.mapper.(clockedMapper); ok {
+			m.storePrgAt(addr, v, b.cpu.accessCycle)
+			return
+		}
+		b.mapper.storePrg(addr, v)
+	}
+}
+
+// loadPort reads the controller port.
+// Only bits 0-4 are driven, and the rest is open bus which keeps
+// the high byte of the address ($40) in most cases.
+func (b *Bus) loadPort(addr word) byte{
+	v := byte(addr >> 8) & 0xE0
+	// devices like the zapper see the picture which the ppu is drawing.
+	b.syncPpu()
+	port := int(addr - 0x4016)
+	if d := b.ports[port]; d != nil {
+		v |= d.Read() & 0x1F
+	}
+	if b.expansion != nil {
+		v |= b.expansion.ReadExpansion(port) & 0x1F
+	}
+	return v
+}
+
+func (b *Bus) loadPpu(addr word) byte{
+	if addr == 0x2002 {
+		return b.ppu.readPpuStatus()
+	} else if addr == 0x2004 {
+		return b.ppu.readOamData()
+	} else if addr == 0x2007 {
+		return b.ppu.readPpuData()
+	}
+
+	// write-only registers return the value left on the ppu data bus.
+	return b.ppu.readLatch()
+}
+
+func (b *Bus) storePpu(addr word, v byte){
+	// any write, even to read-only 0x2002, drives the ppu data bus.
+	b.ppu.refreshLatch(v, 0xFF)
+
+	if b.ppu.isIgnoringWrite(addr) {
+		return
+	}
+
+	if addr == 0x2000 {
 		b.ppu.writePpuCtrl(v)
 	} else if addr == 0x2001 {
 		b.ppu.writePpuMask(v)
@@ -79,22 +139,22 @@ func (b *Bus) Store(addr word, v byte){
 		b.ppu.writePpuAddr(v)
 	} else if addr == 0x2007 {
 		b.ppu.writePpuData(v)
-	} else if addr < 0x4000{
-		// mirror
-		b.Store(addr % 8, v)
-	} else if addr == 0x4014{
-		// DMA
-		b.dmaTransfer(v)
-	} else if addr == 0x4016{
-		// 1P
-		b.controller.write(v)
-	} else if addr < 0x4020{
-		// sound etc..
-	} else {
 	}
 }
 
+// syncPpu lets the ppu catch up with the cycle when the cpu accesses its registers.
+func (b *Bus) syncPpu(){
+	b.ppu.run(b.cpu.accessCycle)
+}
+
+// dmaTransfer copies the page into OAM, which halts the cpu for 513 cycles after the write,
+// and one more to align with the read cycle when it starts on an odd cycle.
 func (b *Bus) dmaTransfer(hund byte) {
+	b.cpu.stall += 513
+	if (b.cpu.accessCycle + 1) % 2 == 1 {
+		b.cpu.stall++
+	}
+
 	addr := word(hund) << 8
 	var i word
 
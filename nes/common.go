@@ -8,7 +8,7 @@ import (
 type word uint16
 
 func abort(format string, v ...interface{}){
-	log.Fatalf(format, v)
+	log.Fatalf(format, v...)
 	os.Exit(1)
 }
 
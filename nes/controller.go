@@ -1,5 +1,50 @@
 package nes
 
+// InputDevice is a device connected to a controller port.
+type InputDevice interface {
+	// Write receives the value written to $4016.
+	// Bits 0-2 are OUT0-OUT2, and OUT0 is the strobe of the standard controller.
+	Write(b byte)
+	// Read returns bits 0-4 of $4016 (port 1) or $4017 (port 2).
+	Read() byte
+}
+
+// ExpansionDevice is a device connected to the expansion port of Famicom,
+// which can drive both $4016 and $4017.
+type ExpansionDevice interface {
+	// Write receives the value written to $4016.
+	Write(b byte)
+	// ReadExpansion returns bits 0-4 of $4016 (Port1) or $4017 (Port2).
+	ReadExpansion(port int) byte
+}
+
+// lightSensor is an input device which senses the picture drawn by the ppu.
+type lightSensor interface {
+	attachPpu(p *Ppu)
+}
+
+const (
+	Port1 = 0
+	Port2 = 1
+)
+
+// Default expansion devices in NES 2.0 header (byte 15).
+const (
+	ExpansionUnspecified    = 0x00
+	ExpansionControllers    = 0x01
+	ExpansionFourScore      = 0x02
+	ExpansionFamicom4P      = 0x03
+	ExpansionZapper         = 0x08
+	ExpansionTwoZappers     = 0x09
+	ExpansionPowerPadA      = 0x0B
+	ExpansionPowerPadB      = 0x0C
+	ExpansionVaus           = 0x0F
+	ExpansionFamicomVaus    = 0x10
+	ExpansionFamilyKeyboard = 0x23
+)
+
+// Controller is the standard controller, which shifts out 8 buttons in order of
+// A, B, Select, Start, Up, Down, Left, Right.
 type Controller struct {
 	reset byte
 	counter int
@@ -16,11 +61,15 @@ func (c *Controller) SetButton(b [8]bool){
 	c.buttons = b
 }
 
-func (c *Controller) read() byte{
-	b := byte(0)
+func (c *Controller) Read() byte{
+	// official controllers return 1 after the 8 buttons are read.
+	b := byte(1)
 
-	if c.counter < 8 && c.buttons[c.counter] {
-		b = 1
+	if c.counter < 8 {
+		b = 0
+		if c.buttons[c.counter] {
+			b = 1
+		}
 	}
 
 	c.counter++
@@ -31,7 +80,7 @@ func (c *Controller) read() byte{
 	return b
 }
 
-func (c *Controller) write(b byte){
+func (c *Controller) Write(b byte){
 	c.reset = b
 	if c.reset & 1 == 1 {
 		c.counter = 0
@@ -13,7 +13,13 @@ type Cpu struct{
 	PC    word
 	cycle uint64
 	bus   *Bus
-	intrrupt func()
+	intrrupt func() // pending irq
+	isNmiPending   bool
+	isResetPending bool
+	interruptCycle uint64 // the cycle when the interrupt was raised
+	accessCycle    uint64 // the cycle when the current instruction accesses the memory
+	isPageCrossed  bool   // the indexed address of the current instruction is on the next page
+	stall          uint64 // cycles added to the current instruction by taken branches and OAM DMA
 }
 
 const(
@@ -216,16 +222,16 @@ func (c *Cpu) asl(isAccumulator bool, addr word){
 		c.updateNZ(c.A)
 
 	}else{
-		v := c.bus.Load(addr)
+		old := c.bus.Load(addr)
 
-		if v >> 7 & 1 == 1{
+		if old >> 7 & 1 == 1{
 			c.setBit(Carry)
 		}else{
 			c.unsetBit(Carry)
 		}
 
-		v <<= 1
-		c.bus.Store(addr, v)
+		v := old << 1
+		c.storeModified(addr, old, v)
 		c.updateNZ(v)
 	}
 }
@@ -280,7 +286,7 @@ func (c *Cpu) cpy(addr word){
 
 func (c *Cpu) dec(addr word){
 	v := c.bus.Load(addr)
-	c.bus.Store(addr, v-1)
+	c.storeModified(addr, v, v-1)
 	c.updateNZ(v-1)
 }
 
@@ -301,7 +307,7 @@ func (c *Cpu) eor(w word){
 
 func (c *Cpu) inc(addr word){
 	v := c.bus.Load(addr)
-	c.bus.Store(addr, v+1)
+	c.storeModified(addr, v, v+1)
 	c.updateNZ(v+1)
 }
 
@@ -327,14 +333,14 @@ func (c *Cpu) lsr(isAccumulator bool, addr word){
 		c.updateNZ(c.A)
 
 	}else{
-		v := c.bus.Load(addr)
-		if v & 1 == 1{
+		old := c.bus.Load(addr)
+		if old & 1 == 1{
 			c.setBit(Carry)
 		} else {
 			c.unsetBit(Carry)
 		}
-		v>>=1
-		c.bus.Store(addr, v)
+		v := old >> 1
+		c.storeModified(addr, old, v)
 		c.updateNZ(v)
 	}
 }
@@ -359,16 +365,16 @@ func (c *Cpu) rol(isAccumulator bool, addr word){
 
 	} else {
 		cv := c.status(Carry)
-		value := c.bus.Load(addr)
+		old := c.bus.Load(addr)
 
-		if (value >> 7) & 1 == 1{
+		if (old >> 7) & 1 == 1{
 			c.setBit(Carry)
 		}else{
 			c.unsetBit(Carry)
 		}
 
-		value = (value << 1) | cv
-		c.bus.Store(addr, value)
+		value := (old << 1) | cv
+		c.storeModified(addr, old, value)
 		c.updateNZ(value)
 	}
 }
@@ -387,16 +393,16 @@ func (c *Cpu) ror(isAccumulator bool, addr word) {
 		c.updateNZ(c.A)
 	} else {
 		cv := c.status(Carry)
-		value := c.bus.Load(addr)
+		old := c.bus.Load(addr)
 
-		if value & 1 == 1{
+		if old & 1 == 1{
 			c.setBit(Carry)
 		}else{
 			c.unsetBit(Carry)
 		}
 
-		value = (value >> 1) | (cv << 7)
-		c.bus.Store(addr, value)
+		value := (old >> 1) | (cv << 7)
+		c.storeModified(addr, old, value)
 		c.updateNZ(value)
 	}
 }
@@ -422,6 +428,18 @@ func (c *Cpu) sbc(addr word){
 	c.updateNZ(c.A)
 }
 
+// storeModified writes the result of the read-modify-write instruction.
+// The 6502 writes the unmodified value back on the cycle before, which is done only on the cartridge
+// for the mappers like MMC1, so the ppu registers still see a single write.
+func (c *Cpu) storeModified(addr word, old byte, v byte){
+	if addr >= 0x6000 {
+		c.accessCycle--
+		c.bus.Store(addr, old)
+		c.accessCycle++
+	}
+	c.bus.Store(addr, v)
+}
+
 func (c *Cpu) push(b byte){
 	c.bus.Store(0x100 | word(c.S), b)
 	c.S--
@@ -481,7 +499,12 @@ func (c *Cpu) rti() {
 	c.PC = c.popWord()
 }
 
+// branch takes a cycle more, and another one when it jumps to another page.
 func (c *Cpu) branch(w word){
+	c.stall++
+	if c.PC & 0xFF00 != w & 0xFF00 {
+		c.stall++
+	}
 	c.PC = w
 }
 
@@ -633,13 +656,13 @@ func (c *Cpu) nmi(){
 	c.cycle+=7
 }
 
+// reset is the same sequence as the other interrupts, but the stack is read instead of written,
+// so only S is decremented by 3. A, X and Y are kept.
 func (c *Cpu) reset(){
-	c.pushWord(c.PC)
-	c.php()
+	c.S -= 3
 	addr := c.bus.Loadw(0xFFFC)
 	c.jmp(addr)
 	c.setBit(Irq)
-	c.unsetBit(Break)
 	c.cycle += 7
 }
 
@@ -653,13 +676,24 @@ func (c *Cpu) irq(){
 }
 
 func (c *Cpu) InterruptNmi(){
-	c.intrrupt = c.nmi
+	c.isNmiPending = true
 }
 
+// cancelNmi drops nmi which has been raised but not handled yet. The other interrupts are kept.
+func (c *Cpu) cancelNmi(){
+	c.isNmiPending = false
+}
+
+// isInterruptDelayed reports whether the interrupt was raised in the last cycle of the previous instruction.
+// The cpu polls interrupts before the last cycle, so such one is handled after the next instruction.
+func (c *Cpu) isInterruptDelayed() bool{
+	return c.interruptCycle >= c.cycle
+}
+
+// interruptReset raises reset, which can't be masked and drops the pending interrupts.
 func (c *Cpu) interruptReset(){
-	if !c.isIrqForbitten(){
-		c.intrrupt = c.reset
-	}
+	c.isResetPending = true
+	c.interruptCycle = 0
 }
 
 func (c *Cpu) interruptIrq(){
@@ -668,6 +702,48 @@ func (c *Cpu) interruptIrq(){
 	}
 }
 
+// handleInterrupt runs the pending interrupt before the next instruction.
+// Reset is prior to nmi, and nmi is prior to irq.
+func (c *Cpu) handleInterrupt(){
+	if c.isInterruptDelayed() {
+		return
+	}
+
+	if c.isResetPending {
+		c.isResetPending = false
+		c.isNmiPending = false
+		c.intrrupt = nil
+		c.reset()
+	} else if c.isNmiPending {
+		c.isNmiPending = false
+		c.nmi()
+	} else if c.intrrupt != nil {
+		c.intrrupt()
+		c.intrrupt = nil
+	}
+}
+
+// pageCrossCycleMnemonics are the instructions which read the memory, and take a cycle more
+// when the indexed address crosses the page. Writes and read-modify-writes always take it.
+var pageCrossCycleMnemonics = map[string]bool{
+	"ADC": true, "AND": true, "CMP": true, "EOR": true, "LDA": true, "LDX": true,
+	"LDY": true, "ORA": true, "SBC": true, "NOP": true, "LAX": true, "LAS": true,
+}
+
+// cycles returns the cycles of the instruction, including a cycle more by the page crossing.
+// solveAddrMode must be called before it.
+func (c *Cpu) cycles(inst Instruction) uint64{
+	if c.isPageCrossed && pageCrossCycleMnemonics[inst.mnemonic] {
+		return inst.cycle + 1
+	}
+	return inst.cycle
+}
+
+// isCrossed reports whether the indexed address is on another page than the base address.
+func isCrossed(base word, addr word) bool{
+	return base & 0xFF00 != addr & 0xFF00
+}
+
 func (c *Cpu) decode(b byte) Instruction{
 	i := instructions[b]
 	if i.mnemonic == ""{
@@ -690,6 +766,7 @@ func (c *Cpu) advance(mode AddrMode){
 }
 
 func (c *Cpu) solveAddrMode(mode AddrMode) word {
+	c.isPageCrossed = false
 	switch mode {
 	case Accumulator:
 		return 0x00
@@ -713,15 +790,21 @@ func (c *Cpu) solveAddrMode(mode AddrMode) word {
 	case Absolute:
 		return c.bus.Loadw(c.PC + 1)
 	case AbsoluteX:
-		return c.bus.Loadw(c.PC + 1) + word(c.X)
+		base := c.bus.Loadw(c.PC + 1)
+		c.isPageCrossed = isCrossed(base, base + word(c.X))
+		return base + word(c.X)
 	case AbsoluteY:
-		return c.bus.Loadw(c.PC + 1) + word(c.Y)
+		base := c.bus.Loadw(c.PC + 1)
+		c.isPageCrossed = isCrossed(base, base + word(c.Y))
+		return base + word(c.Y)
 	case Indirect:
 		return c.bus.BugLoadw(c.bus.Loadw(c.PC + 1))
 	case IndirectX:
 		return c.bus.BugLoadw(word(c.bus.Load(c.PC + 1) + c.X))
 	case IndirectY:
-		return c.bus.BugLoadw(word(c.bus.Load(c.PC + 1))) + word(c.Y)
+		base := c.bus.BugLoadw(word(c.bus.Load(c.PC + 1)))
+		c.isPageCrossed = isCrossed(base, base + word(c.Y))
+		return base + word(c.Y)
 	default:
 		abort("panic: unknown addrMode `%s` was called when solving", mode)
 	}
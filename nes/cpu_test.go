@@ -0,0 +1,163 @@
+package nes
+
+import "testing"
+
+// raiseInterrupts raises the interrupts at $8400 with the I flag clear, which are not delayed.
+func raiseInterrupts(c *Cpu, isNmi bool, isReset bool, isIrq bool) {
+	c.PC = 0x8400
+	c.cycle = 10
+	c.P &^= Irq
+	if isNmi {
+		c.InterruptNmi()
+	}
+	if isReset {
+		c.interruptReset()
+	}
+	if isIrq {
+		c.interruptIrq()
+	}
+}
+
+func TestInterruptPriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		isNmi   bool
+		isReset bool
+		isIrq   bool
+		pc      word
+	}{
+		{"reset", true, true, true, 0x8000},
+		{"nmi", true, false, true, 0x8100},
+		{"irq", false, false, true, 0x8200},
+		{"none", false, false, false, 0x8400},
+	}
+	for _, tt := range tests {
+		c := newTestNes(NTSC).cpu
+		raiseInterrupts(c, tt.isNmi, tt.isReset, tt.isIrq)
+		c.handleInterrupt()
+		if c.PC != tt.pc {
+			t.Errorf("%s: PC $%04X, want $%04X", tt.name, c.PC, tt.pc)
+		}
+	}
+}
+
+func TestIrqIsKeptAfterNmi(t *testing.T) {
+	c := newTestNes(NTSC).cpu
+	raiseInterrupts(c, true, false, true)
+	c.handleInterrupt()
+	c.P &^= Irq
+	c.handleInterrupt()
+	if c.PC != 0x8200 {
+		t.Errorf("PC $%04X after nmi, want irq $8200", c.PC)
+	}
+}
+
+func TestResetDropsPendingInterrupts(t *testing.T) {
+	c := newTestNes(NTSC).cpu
+	raiseInterrupts(c, true, true, true)
+	c.handleInterrupt()
+	if c.isNmiPending || c.intrrupt != nil {
+		t.Error("nmi or irq is pending after reset")
+	}
+}
+
+func TestCancelNmi(t *testing.T) {
+	tests := []struct {
+		name    string
+		isReset bool
+		isIrq   bool
+		pc      word
+	}{
+		{"reset is kept", true, false, 0x8000},
+		{"irq is kept", false, true, 0x8200},
+		{"nothing is left", false, false, 0x8400},
+	}
+	for _, tt := range tests {
+		c := newTestNes(NTSC).cpu
+		raiseInterrupts(c, true, tt.isReset, tt.isIrq)
+		c.cancelNmi()
+		c.handleInterrupt()
+		if c.PC != tt.pc {
+			t.Errorf("%s: PC $%04X, want $%04X", tt.name, c.PC, tt.pc)
+		}
+	}
+}
+
+func TestInterruptInLastCycleIsDelayed(t *testing.T) {
+	c := newTestNes(NTSC).cpu
+	raiseInterrupts(c, true, false, false)
+	c.interruptCycle = c.cycle
+	c.handleInterrupt()
+	if c.PC != 0x8400 || !c.isNmiPending {
+		t.Fatalf("nmi raised in the last cycle is handled before the next instruction")
+	}
+
+	c.cycle++
+	c.handleInterrupt()
+	if c.PC != 0x8100 {
+		t.Errorf("PC $%04X, want nmi $8100", c.PC)
+	}
+}
+
+func TestInstructionCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		pc      word
+		program []byte
+		x, y    byte
+		isZero  bool
+		cycles  uint64
+	}{
+		{"LDA abs,X", 0x8000, []byte{0xBD, 0x00, 0x02}, 0x10, 0, false, 4},
+		{"LDA abs,X crossing", 0x8000, []byte{0xBD, 0xF0, 0x02}, 0x20, 0, false, 5},
+		{"LDA abs,Y crossing", 0x8000, []byte{0xB9, 0xF0, 0x02}, 0, 0x20, false, 5},
+		{"LDA (zp),Y", 0x8000, []byte{0xB1, 0x10}, 0, 0x0F, false, 5},
+		{"LDA (zp),Y crossing", 0x8000, []byte{0xB1, 0x10}, 0, 0x10, false, 6},
+		{"STA abs,X", 0x8000, []byte{0x9D, 0x00, 0x02}, 0x10, 0, false, 5},
+		{"STA abs,X crossing", 0x8000, []byte{0x9D, 0xF0, 0x02}, 0x20, 0, false, 5},
+		{"INC abs,X crossing", 0x8000, []byte{0xFE, 0xF0, 0x02}, 0x20, 0, false, 7},
+		{"BNE not taken", 0x8000, []byte{0xD0, 0x02}, 0, 0, true, 2},
+		{"BNE taken", 0x8000, []byte{0xD0, 0x02}, 0, 0, false, 3},
+		{"BNE taken crossing forward", 0x80F0, []byte{0xD0, 0x10}, 0, 0, false, 4},
+		{"BNE taken crossing backward", 0x8100, []byte{0xD0, 0xF0}, 0, 0, false, 4},
+	}
+	for _, tt := range tests {
+		n := newTestNes(NTSC)
+		copy(n.cassette.PrgRom()[tt.pc - 0x8000:], tt.program)
+		// ($10) = $02F0
+		n.bus.Store(0x10, 0xF0)
+		n.bus.Store(0x11, 0x02)
+
+		c := n.cpu
+		c.PC = tt.pc
+		c.X = tt.x
+		c.Y = tt.y
+		if tt.isZero {
+			c.P |= Zero
+		}
+		n.step()
+		if c.cycle != tt.cycles {
+			t.Errorf("%s: %d cycles, want %d", tt.name, c.cycle, tt.cycles)
+		}
+	}
+}
+
+func TestOamDmaStall(t *testing.T) {
+	tests := []struct {
+		name   string
+		cycle  uint64 // the cycle where STA $4014 starts
+		cycles uint64
+	}{
+		{"even", 0, 4 + 513},
+		{"odd", 1, 4 + 514},
+	}
+	for _, tt := range tests {
+		// STA $4014
+		n := newTestNes(NTSC, 0x8D, 0x14, 0x40)
+		n.cpu.cycle = tt.cycle
+		n.step()
+		if cycles := n.cpu.cycle - tt.cycle; cycles != tt.cycles {
+			t.Errorf("%s: %d cycles, want %d", tt.name, cycles, tt.cycles)
+		}
+	}
+}
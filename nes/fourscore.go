@@ -0,0 +1,87 @@
+package nes
+
+// FourPlayerAdapter connects 4 standard controllers (player 1 - 4) to both ports.
+//
+// NES Four Score: each port shifts out 8 buttons of player 1 (2), 8 buttons of player 3 (4)
+// and 8 bits of the signature in bit 0.
+// Famicom 4 players: players 3 and 4 are on the expansion port, which shifts them out
+// in bit 1 in parallel with players 1 and 2.
+type FourPlayerAdapter struct {
+	pads      [4]*Controller
+	isFamicom bool
+	ports     [2]*fourPlayerPort
+}
+
+// fourScoreSignatures are the bits after the 16 buttons, which tell games the Four Score is connected.
+var fourScoreSignatures = [2]byte{0x10, 0x20}
+
+// fourPlayerPort is the side of FourPlayerAdapter which is connected to a port.
+type fourPlayerPort struct {
+	adapter *FourPlayerAdapter
+	port    int
+	reset   byte
+	counter int
+}
+
+func NewFourScore() *FourPlayerAdapter{
+	return newFourPlayerAdapter(false)
+}
+
+func NewFamicomFourPlayerAdapter() *FourPlayerAdapter{
+	return newFourPlayerAdapter(true)
+}
+
+func newFourPlayerAdapter(isFamicom bool) *FourPlayerAdapter{
+	a := &FourPlayerAdapter{
+		isFamicom: isFamicom,
+	}
+	for i := range a.pads {
+		a.pads[i] = NewController()
+	}
+	for i := range a.ports {
+		a.ports[i] = &fourPlayerPort{adapter: a, port: i}
+	}
+	return a
+}
+
+// Pad returns the controller of the player (0 - 3).
+func (a *FourPlayerAdapter) Pad(player int) *Controller{
+	return a.pads[player]
+}
+
+// Port returns the device which is connected to the port (Port1 or Port2).
+func (a *FourPlayerAdapter) Port(port int) InputDevice{
+	return a.ports[port]
+}
+
+func (p *fourPlayerPort) Write(b byte){
+	p.reset = b
+	if p.reset & 1 == 1 {
+		p.counter = 0
+	}
+	p.adapter.pads[p.port].Write(b)
+	p.adapter.pads[p.port + 2].Write(b)
+}
+
+func (p *fourPlayerPort) Read() byte{
+	a := p.adapter
+	if a.isFamicom {
+		return a.pads[p.port].Read() | a.pads[p.port + 2].Read() << 1
+	}
+
+	// official controllers return 1 after the all bits are read.
+	b := byte(1)
+	if p.counter < 8 {
+		b = a.pads[p.port].Read()
+	} else if p.counter < 16 {
+		b = a.pads[p.port + 2].Read()
+	} else if p.counter < 24 {
+		b = fourScoreSignatures[p.port] >> uint(23 - p.counter) & 0x01
+	}
+
+	p.counter++
+	if p.reset & 1 == 1 {
+		p.counter = 0
+	}
+	return b
+}
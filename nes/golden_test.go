@@ -0,0 +1,463 @@
+package nes
+
+// Golden-frame regression tests.
+//
+// Each case is a script in testdata/golden/*.json, which runs a rom with the scripted input
+// and compares the hash of Buffer at the checkpoints with the golden hash:
+//
+//	{
+//	  "rom": "smb.nes",
+//	  "input": [{"frame": 60, "frames": 2, "player": 1, "buttons": ["Start"]}],
+//	  "checkpoints": [{"frame": 120, "hash": "..."}]
+//	}
+//
+// "frame" of the input is the first frame where the buttons are pushed, for "frames" frames,
+// and "frame" of the checkpoint is the number of frames which have been run.
+// Roms are not in the repository. They are read from $GOONES_ROMS (testdata/roms by default),
+// and the case is skipped when the rom is absent. The rom "fakecart" is the small program below.
+//
+//	go test ./nes -run Golden -update
+//
+// writes the hashes into the scripts, and the pictures into testdata/golden/<script>/<frame>.png.
+// On mismatch, the picture and the diff image from the golden picture are saved into
+// $GOONES_GOLDEN_OUT (goones-golden in the temp dir by default).
+//
+// The test roms of blargg report the result at $6000 instead of the picture:
+//
+//	{"rom": "ppu_vbl_nmi/rom_singles/01-vbl_basics.nes", "blargg": {"frames": 1800}}
+//
+// runs the rom until it reports the result within "frames" frames, and fails with the text
+// of the rom if the result is not 0.
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the golden hashes and pictures")
+
+// fakeCartRom is the name of fakeCart in the scripts.
+const fakeCartRom = "fakecart"
+
+var goldenButtons = []string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right"}
+
+type goldenScript struct {
+	Rom         string             `json:"rom"`
+	Input       []goldenInput      `json:"input,omitempty"`
+	Checkpoints []goldenCheckpoint `json:"checkpoints,omitempty"`
+	Blargg      *goldenBlargg      `json:"blargg,omitempty"`
+}
+
+type goldenInput struct {
+	Frame   int      `json:"frame"`
+	Frames  int      `json:"frames"` // 1 if it is 0
+	Player  int      `json:"player"` // 1 - 4, and 1 if it is 0
+	Buttons []string `json:"buttons"`
+}
+
+type goldenBlargg struct {
+	Frames int `json:"frames"` // frames until the rom reports the result
+}
+
+type goldenCheckpoint struct {
+	Frame int    `json:"frame"`
+	Hash  string `json:"hash"` // sha256 of the RGBA pixels
+}
+
+// buttons returns the buttons of the players in the frame.
+func (s *goldenScript) buttons(frame int) ([4][8]bool, error) {
+	var buttons [4][8]bool
+	for _, in := range s.Input {
+		frames := in.Frames
+		if frames == 0 {
+			frames = 1
+		}
+		if frame < in.Frame || frame >= in.Frame + frames {
+			continue
+		}
+		player := in.Player
+		if player == 0 {
+			player = 1
+		}
+		if player < 1 || player > 4 {
+			return buttons, fmt.Errorf("unknown player %d (1 - 4)", in.Player)
+		}
+		for _, name := range in.Buttons {
+			i := indexOfButton(name)
+			if i < 0 {
+				return buttons, fmt.Errorf("unknown button %q (%s)", name, strings.Join(goldenButtons, ", "))
+			}
+			buttons[player - 1][i] = true
+		}
+	}
+	return buttons, nil
+}
+
+func indexOfButton(name string) int {
+	for i, b := range goldenButtons {
+		if b == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestGolden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			testGolden(t, path)
+		})
+	}
+}
+
+func testGolden(t *testing.T, path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var script goldenScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+
+	cassette := loadGoldenRom(t, script.Rom)
+	n := NewNes(cassette)
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if script.Blargg != nil {
+		testBlargg(t, n, script.Blargg.Frames)
+	}
+
+	dir := strings.TrimSuffix(path, ".json")
+	for i := range script.Checkpoints {
+		cp := &script.Checkpoints[i]
+		for int(n.FrameCount()) < cp.Frame {
+			buttons, err := script.buttons(int(n.FrameCount()))
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			for player, b := range buttons {
+				n.PushButton(player, b)
+			}
+			n.Run()
+		}
+
+		img := n.Screenshot(ScreenshotOptions{})
+		sum := sha256.Sum256(img.Pix)
+		hash := hex.EncodeToString(sum[:])
+		golden := filepath.Join(dir, fmt.Sprintf("%d.png", cp.Frame))
+
+		if *update {
+			cp.Hash = hash
+			if err := savePng(golden, img); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		if cp.Hash == "" {
+			t.Errorf("frame %d: no golden hash, so run with -update", cp.Frame)
+		} else if cp.Hash != hash {
+			t.Errorf("frame %d: hash %s, want %s", cp.Frame, hash, cp.Hash)
+			saveGoldenDiff(t, filepath.Base(dir), cp.Frame, img, golden)
+		}
+	}
+
+	if *update {
+		data, err := json.MarshalIndent(script, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// blarggSignature at $6001 - $6003 tells that $6000 is the status of the test rom.
+var blarggSignature = []byte{0xDE, 0xB0, 0x61}
+
+const(
+	blarggRunning = 0x80
+	blarggNeedsReset = 0x81
+)
+
+// testBlargg runs the test rom until the status at $6000 is the result.
+// The rom asks for reset with $81, which must be pushed after 100ms at least.
+func testBlargg(t *testing.T, n *Nes, frames int) {
+	resetFrame := -1
+	for frame := 0; frame < frames; frame++ {
+		n.Run()
+		if !hasBlarggSignature(n) {
+			continue
+		}
+
+		status := n.bus.mapper.loadPrg(0x6000)
+		switch {
+		case status == blarggNeedsReset:
+			if resetFrame < 0 {
+				resetFrame = frame + 6
+			} else if frame >= resetFrame {
+				n.Reset()
+				resetFrame = -1
+			}
+		case status == blarggRunning:
+		case status == 0:
+			return
+		default:
+			t.Fatalf("result %d: %s", status, blarggText(n))
+		}
+	}
+	t.Fatalf("no result in %d frames: %s", frames, blarggText(n))
+}
+
+func hasBlarggSignature(n *Nes) bool {
+	for i, b := range blarggSignature {
+		if n.bus.mapper.loadPrg(word(0x6001 + i)) != b {
+			return false
+		}
+	}
+	return true
+}
+
+// blarggText returns the text of the test rom from $6004, which ends with 0.
+func blarggText(n *Nes) string {
+	var text []byte
+	for addr := word(0x6004); addr < 0x8000; addr++ {
+		b := n.bus.mapper.loadPrg(addr)
+		if b == 0 {
+			break
+		}
+		text = append(text, b)
+	}
+	return strings.TrimSpace(string(text))
+}
+
+// loadGoldenRom loads the rom from the rom directory, and skips the test if it is absent.
+func loadGoldenRom(t *testing.T, name string) Ines {
+	if name == fakeCartRom {
+		return newFakeCart()
+	}
+
+	dir := os.Getenv("GOONES_ROMS")
+	if dir == "" {
+		dir = filepath.Join("testdata", "roms")
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		t.Skipf("rom %s is absent", path)
+	}
+	cassette, err := NewCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cassette
+}
+
+// saveGoldenDiff saves the picture, and the diff image where the different pixels are red
+// on the dimmed golden picture.
+func saveGoldenDiff(t *testing.T, name string, frame int, img *image.RGBA, golden string) {
+	out := os.Getenv("GOONES_GOLDEN_OUT")
+	if out == "" {
+		out = filepath.Join(os.TempDir(), "goones-golden")
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := filepath.Join(out, fmt.Sprintf("%s-%d.png", name, frame))
+	if err := savePng(actual, img); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("frame %d: picture is saved into %s", frame, actual)
+
+	f, err := os.Open(golden)
+	if err != nil {
+		t.Logf("frame %d: no golden picture to diff: %v", frame, err)
+		return
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Bounds() != img.Bounds() {
+		t.Logf("frame %d: size %v, want %v", frame, img.Bounds().Size(), want.Bounds().Size())
+		return
+	}
+
+	diff := image.NewRGBA(img.Bounds())
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			w := color.RGBAModel.Convert(want.At(x, y)).(color.RGBA)
+			if w != img.RGBAAt(x, y) {
+				diff.SetRGBA(x, y, color.RGBA{R: 0xFF, A: 0xFF})
+				continue
+			}
+			gray := color.GrayModel.Convert(w).(color.Gray).Y / 3
+			diff.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 0xFF})
+		}
+	}
+	path := filepath.Join(out, fmt.Sprintf("%s-%d-diff.png", name, frame))
+	if err := savePng(path, diff); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("frame %d: diff is saved into %s", frame, path)
+}
+
+func savePng(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fakeCart is NROM with CHR-RAM, which runs a small program instead of a rom.
+// It draws a checkered background, scrolls it by a dot every frame,
+// and turns the backdrop red while A of player 1 is pushed.
+type fakeCart struct {
+	prgRom []byte
+}
+
+var fakeCartProgram = []byte{
+	// reset
+	0x78,             // $8000 SEI
+	0xD8,             // $8001 CLD
+	0xA2, 0xFF,       // $8002 LDX #$FF
+	0x9A,             // $8004 TXS
+	0x2C, 0x02, 0x20, // $8005 BIT $2002 (wait for 2 vblanks)
+	0x10, 0xFB,       // $8008 BPL $8005
+	0x2C, 0x02, 0x20, // $800A BIT $2002
+	0x10, 0xFB,       // $800D BPL $800A
+
+	// tile 1 into CHR-RAM
+	0xA9, 0x00,       // $800F LDA #$00
+	0x8D, 0x06, 0x20, // $8011 STA $2006
+	0xA9, 0x10,       // $8014 LDA #$10
+	0x8D, 0x06, 0x20, // $8016 STA $2006
+	0xA2, 0x00,       // $8019 LDX #$00
+	0xBD, 0xA8, 0x80, // $801B LDA $80A8,X
+	0x8D, 0x07, 0x20, // $801E STA $2007
+	0xE8,             // $8021 INX
+	0xE0, 0x10,       // $8022 CPX #$10
+	0xD0, 0xF5,       // $8024 BNE $801B
+
+	// tiles 0 and 1 in turn into the nametable and the attributes
+	0xA9, 0x20,       // $8026 LDA #$20
+	0x8D, 0x06, 0x20, // $8028 STA $2006
+	0xA9, 0x00,       // $802B LDA #$00
+	0x8D, 0x06, 0x20, // $802D STA $2006
+	0xA0, 0x04,       // $8030 LDY #$04
+	0xA2, 0x00,       // $8032 LDX #$00
+	0x8A,             // $8034 TXA
+	0x29, 0x01,       // $8035 AND #$01
+	0x8D, 0x07, 0x20, // $8037 STA $2007
+	0xE8,             // $803A INX
+	0xD0, 0xF7,       // $803B BNE $8034
+	0x88,             // $803D DEY
+	0xD0, 0xF4,       // $803E BNE $8034
+
+	// background palettes
+	0xA9, 0x3F,       // $8040 LDA #$3F
+	0x8D, 0x06, 0x20, // $8042 STA $2006
+	0xA9, 0x00,       // $8045 LDA #$00
+	0x8D, 0x06, 0x20, // $8047 STA $2006
+	0xA2, 0x00,       // $804A LDX #$00
+	0xBD, 0xB8, 0x80, // $804C LDA $80B8,X
+	0x8D, 0x07, 0x20, // $804F STA $2007
+	0xE8,             // $8052 INX
+	0xE0, 0x10,       // $8053 CPX #$10
+	0xD0, 0xF5,       // $8055 BNE $804C
+
+	// enable nmi and the background
+	0xA9, 0x00,       // $8057 LDA #$00
+	0x8D, 0x05, 0x20, // $8059 STA $2005
+	0x8D, 0x05, 0x20, // $805C STA $2005
+	0xA9, 0x80,       // $805F LDA #$80
+	0x8D, 0x00, 0x20, // $8061 STA $2000
+	0xA9, 0x0A,       // $8064 LDA #$0A
+	0x8D, 0x01, 0x20, // $8066 STA $2001
+	0x4C, 0x69, 0x80, // $8069 JMP $8069
+
+	// nmi: read the controller into $00
+	0xA9, 0x01,       // $806C LDA #$01
+	0x8D, 0x16, 0x40, // $806E STA $4016
+	0xA9, 0x00,       // $8071 LDA #$00
+	0x8D, 0x16, 0x40, // $8073 STA $4016
+	0xA2, 0x08,       // $8076 LDX #$08
+	0xAD, 0x16, 0x40, // $8078 LDA $4016
+	0x4A,             // $807B LSR A
+	0x26, 0x00,       // $807C ROL $00
+	0xCA,             // $807E DEX
+	0xD0, 0xF7,       // $807F BNE $8078
+
+	// backdrop is $16 (red) while A is pushed, or $21
+	0xA9, 0x21,       // $8081 LDA #$21
+	0xA6, 0x00,       // $8083 LDX $00
+	0x10, 0x02,       // $8085 BPL $8089
+	0xA9, 0x16,       // $8087 LDA #$16
+	0xA2, 0x3F,       // $8089 LDX #$3F
+	0x8E, 0x06, 0x20, // $808B STX $2006
+	0xA2, 0x00,       // $808E LDX #$00
+	0x8E, 0x06, 0x20, // $8090 STX $2006
+	0x8D, 0x07, 0x20, // $8093 STA $2007
+
+	// scroll x by the frame counter in $01
+	0xE6, 0x01,       // $8096 INC $01
+	0xA9, 0x80,       // $8098 LDA #$80
+	0x8D, 0x00, 0x20, // $809A STA $2000
+	0xA5, 0x01,       // $809D LDA $01
+	0x8D, 0x05, 0x20, // $809F STA $2005
+	0xA9, 0x00,       // $80A2 LDA #$00
+	0x8D, 0x05, 0x20, // $80A4 STA $2005
+	0x40,             // $80A7 RTI
+
+	// tile 1
+	0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0x0F, 0x0F, 0x0F, 0x0F, 0xF0, 0xF0, 0xF0, 0xF0,
+	// palettes
+	0x21, 0x0F, 0x2A, 0x30, 0x21, 0x06, 0x16, 0x27, 0x21, 0x11, 0x12, 0x1C, 0x21, 0x00, 0x10, 0x20,
+}
+
+func newFakeCart() *fakeCart {
+	prg := make([]byte, 0x8000)
+	copy(prg, fakeCartProgram)
+	// nmi $806C, reset $8000, irq $8000
+	copy(prg[0x7FFA:], []byte{0x6C, 0x80, 0x00, 0x80, 0x00, 0x80})
+	return &fakeCart{prgRom: prg}
+}
+
+func (c *fakeCart) PrgRom() []byte           { return c.prgRom }
+func (c *fakeCart) ChrRom() []byte           { return nil }
+func (c *fakeCart) ChrRamSize() int          { return 0x2000 }
+func (c *fakeCart) IsHorizontalMirror() bool { return false }
+func (c *fakeCart) Region() Region           { return NTSC }
+func (c *fakeCart) MapperNo() int            { return MapperNrom }
+func (c *fakeCart) ExpansionDevice() byte    { return ExpansionUnspecified }
+func (c *fakeCart) Checksum() [16]byte       { return md5.Sum(c.prgRom) }
@@ -1,6 +1,7 @@
 package nes
 
 import (
+	"crypto/md5"
 	"fmt"
 	"io/ioutil"
 )
@@ -8,7 +9,12 @@ import (
 type Ines interface {
 	PrgRom() []byte
 	ChrRom() []byte
+	ChrRamSize() int
 	IsHorizontalMirror() bool
+	Region() Region
+	MapperNo() int
+	ExpansionDevice() byte
+	Checksum() [16]byte
 }
 
 const HeaderSize = 0x0010
@@ -25,7 +31,7 @@ func NewCassette(path string) (Ines, error){
 	}
 
 	// prgRom = 0x4000 Byte (16KB) * header[4]
-	// chrRom = 0x2000 Byte (8KB) * header[5]
+	// chrRom = 0x2000 Byte (8KB) * header[5], and CHR-RAM is used instead if it is 0
 	prgRomStart := HeaderSize
 	chrRomStart := HeaderSize + int(bytes[4]) * 0x4000
 	chrROMEnd := chrRomStart + int(bytes[5]) * 0x2000
@@ -35,27 +41,124 @@ func NewCassette(path string) (Ines, error){
 		prgRom = append(prgRom, prgRom...)
 	}
 
-	return &Mapper0{
+	mapperNo := int(bytes[6] >> 4) | int(bytes[7] & 0xF0)
+	if !isSupportedMapper(mapperNo) {
+		return nil, fmt.Errorf("mapper %d is not supported. [PATH] %s", mapperNo, path)
+	}
+
+	checksum := md5.Sum(bytes[prgRomStart:chrROMEnd])
+	return &Cassette{
+		mapperNo:mapperNo,
 		isHorizontalMirror:bytes[6] & 0x01 == 0,
 		prgRom:prgRom,
 		chrRom:bytes[chrRomStart:chrROMEnd],
+		chrRamSize:chrRamSize(bytes),
+		region:detectRegion(bytes, path, checksum),
+		expansionDevice:expansionDevice(bytes),
+		checksum:checksum,
 	}, nil
 }
 
-type Mapper0 struct{
+func isNes2(header []byte) bool{
+	return header[7] & 0x0C == 0x08
+}
+
+// chrRamSize reads the size from NES 2.0 header (byte 11: 64 << shift),
+// or 8KB for iNES which has no CHR-ROM.
+func chrRamSize(header []byte) int{
+	if header[5] != 0 {
+		return 0
+	}
+
+	size := 0x2000
+	if isNes2(header) && header[11] & 0x0F != 0 {
+		size = 64 << (header[11] & 0x0F)
+	}
+
+	// mapper0 always addresses the whole pattern tables.
+	if size < 0x2000 {
+		size = 0x2000
+	}
+	return size
+}
+
+// detectRegion reads the region from NES 2.0 header (byte 12) or the rom database,
+// or guesses it from iNES header (byte 9) and the file name.
+func detectRegion(header []byte, path string, checksum [16]byte) Region{
+	if isNes2(header){
+		switch header[12] & 0x03 {
+		case 1:
+			return PAL
+		case 3:
+			return Dendy
+		default:
+			// 0: NTSC, 2: multiple-region
+			return NTSC
+		}
+	}
+
+	if region, ok := regionFromDatabase(checksum); ok {
+		return region
+	}
+
+	if header[9] & 0x01 != 0 {
+		return PAL
+	}
+
+	if region, ok := regionFromFileName(path); ok {
+		return region
+	}
+	return NTSC
+}
+
+// expansionDevice reads the default expansion device from NES 2.0 header (byte 15),
+// or ExpansionUnspecified for iNES.
+func expansionDevice(header []byte) byte{
+	if !isNes2(header) {
+		return ExpansionUnspecified
+	}
+	return header[15] & 0x3F
+}
+
+type Cassette struct{
+	mapperNo int
 	prgRom []byte
 	chrRom []byte
+	chrRamSize int
 	isHorizontalMirror bool
+	region Region
+	expansionDevice byte
+	checksum [16]byte // md5 of PRG-ROM and CHR-ROM
+}
+
+func (c *Cassette) PrgRom() []byte{
+	return c.prgRom
+}
+
+func (c *Cassette) ChrRom() []byte{
+	return c.chrRom
+}
+
+func (c *Cassette) ChrRamSize() int{
+	return c.chrRamSize
+}
+
+func (c *Cassette) IsHorizontalMirror() bool{
+	return c.isHorizontalMirror
+}
+
+func (c *Cassette) Region() Region{
+	return c.region
 }
 
-func (m *Mapper0) PrgRom() []byte{
-	return m.prgRom
+func (c *Cassette) MapperNo() int{
+	return c.mapperNo
 }
 
-func (m *Mapper0) ChrRom() []byte{
-	return m.chrRom
+func (c *Cassette) ExpansionDevice() byte{
+	return c.expansionDevice
 }
 
-func (m *Mapper0) IsHorizontalMirror() bool{
-	return m.isHorizontalMirror
+func (c *Cassette) Checksum() [16]byte{
+	return c.checksum
 }
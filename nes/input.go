@@ -0,0 +1,132 @@
+package nes
+
+// Default turbo rate in frames, which toggles a button 15 times per second in NTSC.
+const (
+	DefaultTurboOn  = 2
+	DefaultTurboOff = 2
+)
+
+// Macro is a sequence of the buttons (A, B, Select, Start, Up, Down, Left, Right), one for each frame.
+type Macro [][8]bool
+
+// padInput is the input layer in front of the controller of a player.
+// The buttons given by Nes.PushButton and Nes.PushTurbo are combined with turbo and macros
+// once a frame, so keyboard, gamepads and scripts work in the same way.
+type padInput struct {
+	held        [8]bool // buttons given by PushButton
+	turbo       [8]bool // turbo buttons given by PushTurbo
+	turboOn     [8]int  // frames while a turbo button is on
+	turboOff    [8]int  // frames while a turbo button is off
+	turboFrames [8]int  // frames since each turbo button is pushed
+
+	macro       Macro // playing macro
+	macroPos    int
+	recording   Macro
+	isRecording bool
+}
+
+func newPadInput() *padInput{
+	p := &padInput{}
+	for i := range p.turboOn {
+		p.turboOn[i] = DefaultTurboOn
+		p.turboOff[i] = DefaultTurboOff
+	}
+	return p
+}
+
+// next returns the buttons of the next frame.
+func (p *padInput) next() [8]bool{
+	b := p.held
+	for i := range b {
+		if !p.turbo[i] {
+			p.turboFrames[i] = 0
+			continue
+		}
+		if p.turboFrames[i] % (p.turboOn[i] + p.turboOff[i]) < p.turboOn[i] {
+			b[i] = true
+		}
+		p.turboFrames[i]++
+	}
+
+	if p.isRecording {
+		p.recording = append(p.recording, b)
+	}
+
+	if p.macroPos < len(p.macro) {
+		for i, isPushed := range p.macro[p.macroPos] {
+			b[i] = b[i] || isPushed
+		}
+		p.macroPos++
+	}
+	return b
+}
+
+// updateInputs feeds the buttons of the frame to the controllers, through the movie if it is set.
+// The reset commands go through the movie in the same way.
+func (n *Nes) updateInputs() {
+	var buttons [4][8]bool
+	isPlayerInput := false
+	for player, p := range n.inputs {
+		buttons[player] = p.next()
+		if buttons[player] != [8]bool{} {
+			isPlayerInput = true
+		}
+	}
+
+	commands := n.commands
+	n.commands = 0
+	if n.movie != nil {
+		buttons, commands = n.movie.update(n, buttons, commands, isPlayerInput)
+	}
+	n.doCommands(commands)
+
+	for player, b := range buttons {
+		if c := n.pad(player); c != nil {
+			c.SetButton(b)
+		}
+	}
+}
+
+// PushTurbo sets the turbo buttons of the player (0 - 3),
+// which are turned on and off repeatedly while they are pushed.
+func (n *Nes) PushTurbo(player int, b [8]bool) {
+	n.inputs[player].turbo = b
+}
+
+// SetTurboRate sets how many frames the turbo button of the player keeps on and off.
+func (n *Nes) SetTurboRate(player int, button int, on int, off int) {
+	if on < 1 {
+		on = 1
+	}
+	if off < 1 {
+		off = 1
+	}
+	n.inputs[player].turboOn[button] = on
+	n.inputs[player].turboOff[button] = off
+}
+
+// StartMacroRecording starts recording the buttons of the player for each frame.
+func (n *Nes) StartMacroRecording(player int) {
+	p := n.inputs[player]
+	p.recording = nil
+	p.isRecording = true
+}
+
+// StopMacroRecording stops recording and returns the macro.
+func (n *Nes) StopMacroRecording(player int) Macro {
+	p := n.inputs[player]
+	p.isRecording = false
+	return p.recording
+}
+
+// IsRecordingMacro reports whether the buttons of the player are being recorded.
+func (n *Nes) IsRecordingMacro(player int) bool {
+	return n.inputs[player].isRecording
+}
+
+// PlayMacro pushes the buttons of the macro from the next frame, in addition to the buttons of the player.
+func (n *Nes) PlayMacro(player int, m Macro) {
+	p := n.inputs[player]
+	p.macro = m
+	p.macroPos = 0
+}
@@ -0,0 +1,87 @@
+package nes
+
+import "fmt"
+
+// familyKeyboardMatrix is the key matrix of the Family BASIC keyboard,
+// in order of row, column and bits 1-4 of $4017.
+var familyKeyboardMatrix = [9][2][4]string{
+	{{"]", "[", "RETURN", "F8"}, {"STOP", "YEN", "RSHIFT", "KANA"}},
+	{{";", ":", "@", "F7"}, {"^", "-", "/", "_"}},
+	{{"K", "L", "O", "F6"}, {"0", "P", ",", "."}},
+	{{"J", "U", "I", "F5"}, {"8", "9", "N", "M"}},
+	{{"H", "G", "Y", "F4"}, {"6", "7", "V", "B"}},
+	{{"D", "R", "T", "F3"}, {"4", "5", "C", "F"}},
+	{{"A", "S", "W", "F2"}, {"3", "E", "Z", "X"}},
+	{{"CTR", "Q", "ESC", "F1"}, {"2", "1", "GRPH", "LSHIFT"}},
+	{{"LEFT", "RIGHT", "UP", "CLR"}, {"INS", "DEL", "SPACE", "DOWN"}},
+}
+
+// FamilyKeyboard is the keyboard of Family BASIC on the expansion port of Famicom.
+// Writes to $4016 select the row and the column, and $4017 returns 4 keys of them.
+type FamilyKeyboard struct {
+	keys      map[string]bool
+	row       int
+	column    int
+	isEnabled bool
+}
+
+func NewFamilyKeyboard() *FamilyKeyboard{
+	return &FamilyKeyboard{
+		keys: map[string]bool{},
+	}
+}
+
+// IsFamilyKey reports whether the name is a key of the keyboard, e.g. "A", "RETURN" or "F1".
+func IsFamilyKey(name string) bool{
+	for _, row := range familyKeyboardMatrix {
+		for _, column := range row {
+			for _, key := range column {
+				if key == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// PushKey pushes or releases the key which is named in the matrix.
+func (k *FamilyKeyboard) PushKey(name string, isPushed bool) error{
+	if !IsFamilyKey(name) {
+		return fmt.Errorf("unknown key of the family keyboard: %s", name)
+	}
+	k.keys[name] = isPushed
+	return nil
+}
+
+// Write selects the row and the column.
+// bit 0: reset to row 0, bit 1: column (the row advances when it goes from 1 to 0), bit 2: enable.
+func (k *FamilyKeyboard) Write(b byte){
+	column := int(b >> 1 & 0x01)
+	if k.column == 1 && column == 0 {
+		k.row++
+	}
+	k.column = column
+	if b & 0x01 != 0 {
+		k.row = 0
+	}
+	k.isEnabled = b & 0x04 != 0
+}
+
+// ReadExpansion returns the keys in bits 1-4 of $4017, which are 0 when they are pushed.
+func (k *FamilyKeyboard) ReadExpansion(port int) byte{
+	if port != Port2 || !k.isEnabled {
+		return 0
+	}
+	if k.row >= len(familyKeyboardMatrix) {
+		return 0x1E
+	}
+
+	b := byte(0)
+	for i, key := range familyKeyboardMatrix[k.row][k.column] {
+		if !k.keys[key] {
+			b |= 0x02 << uint(i)
+		}
+	}
+	return b
+}
@@ -0,0 +1,109 @@
+package nes
+
+// Mapper maps the cpu address (0x6000 - 0xFFFF) and the ppu address (0x0000 - 0x1FFF) onto the cassette.
+type Mapper interface {
+	loadPrg(addr word) byte
+	storePrg(addr word, b byte)
+	loadChr(addr word) byte
+	storeChr(addr word, b byte)
+	isHorizontalMirror() bool
+}
+
+// cartRamMapper is the mapper which has RAM on the cartridge, e.g. PRG-RAM and CHR-RAM.
+type cartRamMapper interface {
+	cartRam() [][]byte
+}
+
+// nameTableMapper is the mapper which maps the nametables itself, e.g. one-screen mirroring.
+type nameTableMapper interface {
+	mirrorNameTable(addr word) word
+}
+
+// clockedMapper is the mapper which sees the cpu cycle of the writes, e.g. to drop consecutive writes.
+type clockedMapper interface {
+	storePrgAt(addr word, b byte, cycle uint64)
+}
+
+// PrgRamSize is the size of PRG-RAM at $6000 - $7FFF, which is also used by test roms to report the result.
+const PrgRamSize = 0x2000
+
+const(
+	MapperNrom = 0
+	MapperMmc1 = 1
+	MapperMmc2 = 9
+)
+
+func isSupportedMapper(mapperNo int) bool{
+	return mapperNo == MapperNrom || mapperNo == MapperMmc1 || mapperNo == MapperMmc2
+}
+
+func newMapper(cassette Ines) Mapper{
+	switch cassette.MapperNo() {
+	case MapperMmc1:
+		return NewMmc1(cassette)
+	case MapperMmc2:
+		return NewMmc2(cassette)
+	default:
+		return NewNrom(cassette)
+	}
+}
+
+// newChr returns CHR-ROM of the cassette, or CHR-RAM if it has no CHR-ROM.
+func newChr(cassette Ines) Mem {
+	if len(cassette.ChrRom()) > 0 {
+		return NewRom(cassette.ChrRom())
+	}
+	return NewRam(cassette.ChrRamSize())
+}
+
+// Nrom is mapper0, which has no bank switching.
+type Nrom struct{
+	prgRom []byte
+	prgRam []byte
+	chr Mem
+	isHorizontal bool
+}
+
+func NewNrom(cassette Ines) Mapper{
+	return &Nrom{
+		prgRom:cassette.PrgRom(),
+		prgRam:make([]byte, PrgRamSize),
+		chr:newChr(cassette),
+		isHorizontal:cassette.IsHorizontalMirror(),
+	}
+}
+
+func (m *Nrom) loadPrg(addr word) byte{
+	if addr < 0x8000 {
+		return m.prgRam[addr - 0x6000]
+	}
+	return m.prgRom[addr - 0x8000]
+}
+
+func (m *Nrom) storePrg(addr word, b byte){
+	// no registers
+	if addr < 0x8000 {
+		m.prgRam[addr - 0x6000] = b
+	}
+}
+
+func (m *Nrom) loadChr(addr word) byte{
+	return m.chr.load(addr)
+}
+
+func (m *Nrom) storeChr(addr word, b byte){
+	// CHR-ROM ignores it, CHR-RAM is writable.
+	m.chr.store(addr, b)
+}
+
+func (m *Nrom) isHorizontalMirror() bool{
+	return m.isHorizontal
+}
+
+// cartRam returns PRG-RAM and CHR-RAM, which is empty if the cassette has CHR-ROM.
+func (m *Nrom) cartRam() [][]byte{
+	if ram, ok := m.chr.(*Ram); ok {
+		return [][]byte{m.prgRam, ram.data}
+	}
+	return [][]byte{m.prgRam}
+}
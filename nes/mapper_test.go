@@ -0,0 +1,20 @@
+package nes
+
+import "testing"
+
+func TestNromPrgRam(t *testing.T) {
+	n := newTestNes(NTSC)
+	n.bus.Store(0x6000, 0x12)
+	n.bus.Store(0x7FFF, 0x34)
+	n.bus.Store(0x8000, 0x56)
+
+	if b := n.bus.Load(0x6000); b != 0x12 {
+		t.Errorf("$6000 is $%02X, want $12", b)
+	}
+	if b := n.bus.Load(0x7FFF); b != 0x34 {
+		t.Errorf("$7FFF is $%02X, want $34", b)
+	}
+	if b := n.bus.Load(0x8000); b != 0x00 {
+		t.Errorf("PRG-ROM $8000 is written to $%02X", b)
+	}
+}
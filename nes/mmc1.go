@@ -0,0 +1,161 @@
+package nes
+
+// Mmc1 is mapper1 (SxROM, e.g. The Legend of Zelda), which is also used by many test roms.
+// The registers are written a bit at a time through the serial port at $8000 - $FFFF,
+// which ignores the write on the cycle just after the previous one, e.g. the second write of INC $8000.
+type Mmc1 struct{
+	prgRom []byte
+	prgRam []byte
+	chr []byte
+	isChrRam bool
+	shift byte // bits written to the serial port, with the marker bit which tells the fifth write
+	control byte // mirroring (bit 0-1), PRG bank mode (bit 2-3) and CHR bank mode (bit 4)
+	chrBanks [2]int
+	prgBank int
+	isPrgRamDisabled bool // bit 4 of $E000 (MMC1B)
+	serialCycle int64 // the cpu cycle of the last write to the serial port
+}
+
+func NewMmc1(cassette Ines) Mapper{
+	m := &Mmc1{
+		prgRom:cassette.PrgRom(),
+		prgRam:make([]byte, PrgRamSize),
+		chr:cassette.ChrRom(),
+		shift:0x10,
+		control:0x0C,
+		serialCycle:-2,
+	}
+	if len(m.chr) == 0 {
+		m.chr = make([]byte, cassette.ChrRamSize())
+		m.isChrRam = true
+	}
+	if !cassette.IsHorizontalMirror() {
+		m.control |= 0x02
+	} else {
+		m.control |= 0x03
+	}
+	return m
+}
+
+func (m *Mmc1) loadPrg(addr word) byte{
+	if addr < 0x8000 {
+		if m.isPrgRamDisabled {
+			// open bus, which keeps the high byte of the address in most cases
+			return byte(addr >> 8)
+		}
+		return m.prgRam[addr - 0x6000]
+	}
+
+	// 16KB banks
+	bank := m.prgBank
+	switch (m.control >> 2) & 0x03 {
+	case 0, 1:
+		// 32KB at $8000, which ignores the low bit of the bank
+		bank = bank &^ 1 + int(addr - 0x8000) / 0x4000
+	case 2:
+		// the first bank is fixed at $8000
+		if addr < 0xC000 {
+			bank = 0
+		}
+	case 3:
+		// the last bank is fixed at $C000
+		if addr >= 0xC000 {
+			bank = len(m.prgRom) / 0x4000 - 1
+		}
+	}
+	return m.prgRom[(bank * 0x4000 + int(addr % 0x4000)) % len(m.prgRom)]
+}
+
+func (m *Mmc1) storePrg(addr word, b byte){
+	if addr < 0x8000 {
+		if !m.isPrgRamDisabled {
+			m.prgRam[addr - 0x6000] = b
+		}
+		return
+	}
+
+	if b & 0x80 != 0 {
+		m.shift = 0x10
+		m.control |= 0x0C
+		return
+	}
+
+	isFull := m.shift & 0x01 != 0
+	m.shift = m.shift >> 1 | (b & 0x01) << 4
+	if !isFull {
+		return
+	}
+
+	switch addr & 0xE000 {
+	case 0x8000:
+		m.control = m.shift
+	case 0xA000:
+		m.chrBanks[0] = int(m.shift)
+	case 0xC000:
+		m.chrBanks[1] = int(m.shift)
+	case 0xE000:
+		m.prgBank = int(m.shift & 0x0F)
+		m.isPrgRamDisabled = m.shift & 0x10 != 0
+	}
+	m.shift = 0x10
+}
+
+// storePrgAt writes at the cpu cycle, and drops the write to the serial port
+// on the cycle just after the previous one.
+func (m *Mmc1) storePrgAt(addr word, b byte, cycle uint64){
+	if addr >= 0x8000 {
+		isConsecutive := int64(cycle) == m.serialCycle + 1
+		m.serialCycle = int64(cycle)
+		if isConsecutive {
+			return
+		}
+	}
+	m.storePrg(addr, b)
+}
+
+// chrAddr returns the offset of CHR by the 4KB banks, or the 8KB bank which ignores the low bit.
+func (m *Mmc1) chrAddr(addr word) int{
+	if m.control & 0x10 == 0 {
+		return ((m.chrBanks[0] &^ 1) * 0x1000 + int(addr)) % len(m.chr)
+	}
+	bank := m.chrBanks[addr / 0x1000]
+	return (bank * 0x1000 + int(addr % 0x1000)) % len(m.chr)
+}
+
+func (m *Mmc1) loadChr(addr word) byte{
+	return m.chr[m.chrAddr(addr)]
+}
+
+func (m *Mmc1) storeChr(addr word, b byte){
+	if m.isChrRam {
+		m.chr[m.chrAddr(addr)] = b
+	}
+}
+
+func (m *Mmc1) isHorizontalMirror() bool{
+	return m.control & 0x03 == 0x03
+}
+
+// mirrorNameTable maps the nametables by the mirroring of the control register.
+// 0: one-screen at $2000, 1: one-screen at $2400, 2: vertical, 3: horizontal
+func (m *Mmc1) mirrorNameTable(addr word) word{
+	offset := addr & 0x03FF
+	switch m.control & 0x03 {
+	case 0:
+		return 0x2000 | offset
+	case 1:
+		return 0x2400 | offset
+	case 2:
+		return 0x2000 | addr & 0x07FF
+	default:
+		return 0x2000 | (addr & 0x0800) >> 1 | offset
+	}
+}
+
+// cartRam returns PRG-RAM and CHR-RAM if the cassette has no CHR-ROM.
+func (m *Mmc1) cartRam() [][]byte{
+	if m.isChrRam {
+		return [][]byte{m.prgRam, m.chr}
+	}
+	return [][]byte{m.prgRam}
+}
@@ -0,0 +1,105 @@
+package nes
+
+import "testing"
+
+// newMmc1Nes returns the console with MMC1 and 128KB PRG-ROM, whose 16KB banks start with the bank number.
+func newMmc1Nes() *Nes {
+	prg := make([]byte, 0x20000)
+	for bank := 0; bank < 8; bank++ {
+		prg[bank * 0x4000] = byte(bank)
+	}
+	copy(prg[0x1FFFA:], []byte{0x00, 0xC1, 0x00, 0xC0, 0x00, 0xC2})
+	n := NewNes(&testCart{prgRom: prg, region: NTSC, mapperNo: MapperMmc1})
+	n.Init()
+	return n
+}
+
+// writeMmc1 writes the register through the serial port, a bit at a time on separate cycles.
+func writeMmc1(n *Nes, addr word, v byte) {
+	for i := uint(0); i < 5; i++ {
+		n.cpu.accessCycle += 2
+		n.bus.Store(addr, v >> i & 0x01)
+	}
+}
+
+func TestMmc1PrgBanks(t *testing.T) {
+	tests := []struct {
+		name    string
+		control byte
+		bank    byte
+		low     byte // bank at $8000
+		high    byte // bank at $C000
+	}{
+		{"last bank fixed", 0x0C, 2, 2, 7},
+		{"first bank fixed", 0x08, 2, 0, 2},
+		{"32KB", 0x00, 5, 4, 5},
+	}
+	for _, tt := range tests {
+		n := newMmc1Nes()
+		writeMmc1(n, 0x8000, tt.control)
+		writeMmc1(n, 0xE000, tt.bank)
+		if low, high := n.bus.Load(0x8000), n.bus.Load(0xC000); low != tt.low || high != tt.high {
+			t.Errorf("%s: banks %d and %d, want %d and %d", tt.name, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+// TestMmc1ConsecutiveWrite runs INC $8000 on the bank 0 which starts with 0.
+// MMC1 takes the unmodified value written back by INC, and drops the result on the next cycle.
+func TestMmc1ConsecutiveWrite(t *testing.T) {
+	n := newMmc1Nes()
+	m := n.bus.mapper.(*Mmc1)
+	copy(n.cassette.PrgRom()[0x1C000:], []byte{0xEE, 0x00, 0x80})
+	n.cpu.PC = 0xC000
+	n.step()
+
+	if m.shift != 0x08 {
+		t.Errorf("shift register $%02X after INC, want one bit of 0 ($08)", m.shift)
+	}
+
+	// the writes on separate cycles are all taken
+	n.cpu.accessCycle += 2
+	n.bus.Store(0x8000, 0x01)
+	if m.shift != 0x14 {
+		t.Errorf("shift register $%02X after the next write, want $14", m.shift)
+	}
+}
+
+func TestMmc1PrgRamDisable(t *testing.T) {
+	n := newMmc1Nes()
+	n.bus.Store(0x6000, 0x12)
+
+	writeMmc1(n, 0xE000, 0x10)
+	n.bus.Store(0x6000, 0x34)
+	if b := n.bus.Load(0x6000); b != 0x60 {
+		t.Errorf("disabled PRG-RAM reads $%02X, want open bus $60", b)
+	}
+
+	writeMmc1(n, 0xE000, 0x00)
+	if b := n.bus.Load(0x6000); b != 0x12 {
+		t.Errorf("PRG-RAM is $%02X after it is enabled again, want $12", b)
+	}
+}
+
+func TestMmc1Mirroring(t *testing.T) {
+	tests := []struct {
+		control byte
+		addrs   [4]word // $2000, $2400, $2800 and $2C00
+	}{
+		{0x0C, [4]word{0x2000, 0x2000, 0x2000, 0x2000}},
+		{0x0D, [4]word{0x2400, 0x2400, 0x2400, 0x2400}},
+		{0x0E, [4]word{0x2000, 0x2400, 0x2000, 0x2400}},
+		{0x0F, [4]word{0x2000, 0x2000, 0x2400, 0x2400}},
+	}
+	for _, tt := range tests {
+		n := newMmc1Nes()
+		m := n.bus.mapper.(*Mmc1)
+		writeMmc1(n, 0x8000, tt.control)
+		for i, want := range tt.addrs {
+			addr := 0x2000 + word(i) * 0x400
+			if got := m.mirrorNameTable(addr + 0x10); got != want + 0x10 {
+				t.Errorf("control $%02X: $%04X is mapped to $%04X, want $%04X", tt.control, addr + 0x10, got, want + 0x10)
+			}
+		}
+	}
+}
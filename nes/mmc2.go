@@ -0,0 +1,85 @@
+package nes
+
+// Mmc2 is mapper9 (Punch-Out!!).
+// It switches CHR banks when the ppu fetches the tile $FD or $FE,
+// so it observes the ppu address bus.
+type Mmc2 struct{
+	prgRom []byte
+	chrRom []byte
+	prgBank int
+	chrBanks [4]int // 4KB banks: $0000 for $FD, $0000 for $FE, $1000 for $FD, $1000 for $FE
+	latches [2]byte // $FD or $FE for $0000 and $1000
+	isHorizontal bool
+}
+
+func NewMmc2(cassette Ines) Mapper{
+	return &Mmc2{
+		prgRom:cassette.PrgRom(),
+		chrRom:cassette.ChrRom(),
+		latches:[2]byte{0xFE, 0xFE},
+		isHorizontal:cassette.IsHorizontalMirror(),
+	}
+}
+
+func (m *Mmc2) loadPrg(addr word) byte{
+	if addr < 0x8000 {
+		// no PRG-RAM
+		return 0
+	}
+
+	// 0x8000 - 0x9FFF is switchable, and 0xA000 - 0xFFFF is fixed to the last three 8KB banks.
+	bank := m.prgBank
+	if addr >= 0xA000 {
+		bank = len(m.prgRom) / 0x2000 - 3 + int(addr - 0xA000) / 0x2000
+	}
+	return m.prgRom[bank * 0x2000 + int(addr % 0x2000)]
+}
+
+func (m *Mmc2) storePrg(addr word, b byte){
+	switch addr & 0xF000 {
+	case 0xA000:
+		m.prgBank = int(b & 0x0F)
+	case 0xB000:
+		m.chrBanks[0] = int(b & 0x1F)
+	case 0xC000:
+		m.chrBanks[1] = int(b & 0x1F)
+	case 0xD000:
+		m.chrBanks[2] = int(b & 0x1F)
+	case 0xE000:
+		m.chrBanks[3] = int(b & 0x1F)
+	case 0xF000:
+		m.isHorizontal = b & 0x01 != 0
+	}
+}
+
+func (m *Mmc2) loadChr(addr word) byte{
+	table := int(addr / 0x1000)
+	bank := m.chrBanks[table * 2]
+	if m.latches[table] == 0xFE {
+		bank = m.chrBanks[table * 2 + 1]
+	}
+	return m.chrRom[(bank * 0x1000 + int(addr % 0x1000)) % len(m.chrRom)]
+}
+
+func (m *Mmc2) storeChr(addr word, b byte){
+	// CHR-ROM only
+}
+
+func (m *Mmc2) isHorizontalMirror() bool{
+	return m.isHorizontal
+}
+
+// ObservePpuBus switches the latches after the ppu reads the tile $FD or $FE,
+// so the tile itself is still drawn with the previous bank.
+func (m *Mmc2) ObservePpuBus(addr uint16){
+	switch {
+	case addr == 0x0FD8:
+		m.latches[0] = 0xFD
+	case addr == 0x0FE8:
+		m.latches[0] = 0xFE
+	case addr >= 0x1FD8 && addr <= 0x1FDF:
+		m.latches[1] = 0xFD
+	case addr >= 0x1FE8 && addr <= 0x1FEF:
+		m.latches[1] = 0xFE
+	}
+}
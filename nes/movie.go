@@ -0,0 +1,438 @@
+package nes
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Port types of FM2.
+const (
+	MoviePortNone    = 0
+	MoviePortGamepad = 1
+	MoviePortZapper  = 2
+)
+
+// Commands of FM2, which are done at the start of the frame.
+const (
+	MovieSoftReset = 0x01
+	MovieHardReset = 0x02
+)
+
+// movieChecksumInterval is how often the checksum of WRAM is recorded, in frames.
+const movieChecksumInterval = 60
+
+// movieButtons is the order of the buttons in FM2, which is the reverse of the controller.
+const movieButtons = "RLDUTSBA"
+
+// MovieFrame is the input of a frame.
+type MovieFrame struct {
+	Commands byte
+	Buttons  [4][8]bool // A, B, Select, Start, Up, Down, Left, Right of players 1 - 4
+}
+
+// Movie is the input log in the FM2 format of FCEUX, recorded from power-on.
+// The checksums of WRAM are kept in "goonesChecksum <frame> <crc32>" lines of the header,
+// which other emulators ignore, to detect desyncs.
+type Movie struct {
+	RomFilename   string
+	RomChecksum   [16]byte // md5 of PRG-ROM and CHR-ROM
+	Guid          string
+	IsPal         bool
+	IsFourScore   bool
+	Ports         [2]int
+	RerecordCount int
+	Comments      []string
+	Frames        []MovieFrame
+	Checksums     map[int]uint32
+}
+
+// NewMovie makes an empty movie for the cassette which is inserted in n.
+// Only the standard controllers are recorded.
+func (n *Nes) NewMovie(romFilename string) (*Movie, error) {
+	guid, err := newGuid()
+	if err != nil {
+		return nil, err
+	}
+	m := &Movie{
+		RomFilename: romFilename,
+		RomChecksum: n.cassette.Checksum(),
+		Guid:        guid,
+		IsPal:       n.region != NTSC,
+		Checksums:   map[int]uint32{},
+	}
+	for port, d := range n.bus.ports {
+		switch d.(type) {
+		case *Controller:
+			m.Ports[port] = MoviePortGamepad
+		case *fourPlayerPort:
+			m.IsFourScore = true
+			m.Ports[port] = MoviePortGamepad
+		}
+	}
+	return m, nil
+}
+
+func newGuid() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot make the guid of the movie: %v", err)
+	}
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// LoadMovie reads the FM2 file.
+func LoadMovie(path string) (*Movie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := ReadMovie(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// ReadMovie reads the movie in the FM2 format.
+func ReadMovie(r io.Reader) (*Movie, error) {
+	m := &Movie{
+		Checksums: map[int]uint32{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+
+		var err error
+		if text[0] == '|' {
+			err = m.parseFrame(text)
+		} else {
+			err = m.parseHeader(text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Movie) parseHeader(text string) error {
+	fields := strings.SplitN(text, " ", 2)
+	key := fields[0]
+	value := ""
+	if len(fields) == 2 {
+		value = fields[1]
+	}
+
+	var err error
+	switch key {
+	case "romFilename":
+		m.RomFilename = value
+	case "romChecksum":
+		var b []byte
+		b, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "base64:"))
+		copy(m.RomChecksum[:], b)
+	case "guid":
+		m.Guid = value
+	case "palFlag":
+		m.IsPal = value == "1"
+	case "fourscore":
+		m.IsFourScore = value == "1"
+	case "port0":
+		m.Ports[0], err = strconv.Atoi(value)
+	case "port1":
+		m.Ports[1], err = strconv.Atoi(value)
+	case "rerecordCount":
+		m.RerecordCount, err = strconv.Atoi(value)
+	case "comment":
+		m.Comments = append(m.Comments, value)
+	case "savestate":
+		return fmt.Errorf("movies from a save state are not supported")
+	case "goonesChecksum":
+		var frame int
+		var sum uint32
+		if _, err = fmt.Sscanf(value, "%d %x", &frame, &sum); err == nil {
+			m.Checksums[frame] = sum
+		}
+	}
+	// other keys, e.g. version, emuVersion and binary, are ignored.
+
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return nil
+}
+
+func parseMovieButtons(field string) ([8]bool, error) {
+	var b [8]bool
+	if len(field) != len(movieButtons) {
+		return b, fmt.Errorf("invalid buttons %q", field)
+	}
+	for i := 0; i < len(movieButtons); i++ {
+		if field[i] != '.' && field[i] != ' ' {
+			b[7 - i] = true
+		}
+	}
+	return b, nil
+}
+
+// parseFrame reads "|commands|port0|port1|port2|", or "|commands|1P|2P|3P|4P|port2|" with the Four Score.
+func (m *Movie) parseFrame(text string) error {
+	fields := strings.Split(text, "|")
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid frame %q", text)
+	}
+	fields = fields[1:]
+
+	var frame MovieFrame
+	commands, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("invalid commands %q", fields[0])
+	}
+	frame.Commands = byte(commands)
+
+	pads := 2
+	if m.IsFourScore {
+		pads = 4
+	}
+	for player := 0; player < pads; player++ {
+		if 1 + player >= len(fields) {
+			break
+		}
+		field := fields[1 + player]
+		if !m.IsFourScore && m.Ports[player] != MoviePortGamepad {
+			if m.Ports[player] == MoviePortZapper {
+				return fmt.Errorf("zapper in movies is not supported")
+			}
+			continue
+		}
+		if frame.Buttons[player], err = parseMovieButtons(field); err != nil {
+			return err
+		}
+	}
+
+	m.Frames = append(m.Frames, frame)
+	return nil
+}
+
+// Save writes the movie to the FM2 file.
+func (m *Movie) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the movie in the FM2 format.
+func (m *Movie) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	flag := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(bw, "version 3\n")
+	fmt.Fprintf(bw, "emuVersion 0\n")
+	fmt.Fprintf(bw, "rerecordCount %d\n", m.RerecordCount)
+	fmt.Fprintf(bw, "palFlag %d\n", flag(m.IsPal))
+	fmt.Fprintf(bw, "romFilename %s\n", m.RomFilename)
+	fmt.Fprintf(bw, "romChecksum base64:%s\n", base64.StdEncoding.EncodeToString(m.RomChecksum[:]))
+	fmt.Fprintf(bw, "guid %s\n", m.Guid)
+	fmt.Fprintf(bw, "fourscore %d\n", flag(m.IsFourScore))
+	fmt.Fprintf(bw, "microphone 0\n")
+	fmt.Fprintf(bw, "port0 %d\n", m.Ports[0])
+	fmt.Fprintf(bw, "port1 %d\n", m.Ports[1])
+	fmt.Fprintf(bw, "port2 0\n")
+	for _, c := range m.Comments {
+		fmt.Fprintf(bw, "comment %s\n", c)
+	}
+
+	frames := make([]int, 0, len(m.Checksums))
+	for frame := range m.Checksums {
+		frames = append(frames, frame)
+	}
+	sort.Ints(frames)
+	for _, frame := range frames {
+		fmt.Fprintf(bw, "goonesChecksum %d %08x\n", frame, m.Checksums[frame])
+	}
+
+	pads := []int{0, 1}
+	if m.IsFourScore {
+		pads = []int{0, 1, 2, 3}
+	}
+	for _, frame := range m.Frames {
+		fmt.Fprintf(bw, "|%d|", frame.Commands)
+		for _, player := range pads {
+			if m.IsFourScore || m.Ports[player] == MoviePortGamepad {
+				bw.WriteString(formatMovieButtons(frame.Buttons[player]))
+			}
+			bw.WriteString("|")
+		}
+		bw.WriteString("|\n")
+	}
+	return bw.Flush()
+}
+
+func formatMovieButtons(b [8]bool) string {
+	s := []byte(movieButtons)
+	for i := range s {
+		if !b[7 - i] {
+			s[i] = '.'
+		}
+	}
+	return string(s)
+}
+
+// MovieMode is how the movie is played.
+type MovieMode int
+
+const (
+	// MovieReadOnly ignores the input of the players while playing.
+	MovieReadOnly MovieMode = iota
+	// MovieReadWrite cuts the movie and records from there when the players push any button.
+	MovieReadWrite
+)
+
+// moviePlayer records or plays the movie along the frames since power-on.
+type moviePlayer struct {
+	movie       *Movie
+	mode        MovieMode
+	isRecording bool
+	desyncFrame int // the first frame whose checksum is not matched, or -1
+}
+
+// RecordMovie starts recording the input into the movie. It must be called before the first frame.
+func (n *Nes) RecordMovie(m *Movie) error {
+	if n.frameCount != 0 {
+		return fmt.Errorf("movies must be recorded from power-on")
+	}
+	m.Frames = nil
+	m.Checksums = map[int]uint32{}
+	n.movie = &moviePlayer{movie: m, isRecording: true, desyncFrame: -1}
+	return nil
+}
+
+// PlayMovie starts playing the movie. It must be called before the first frame.
+func (n *Nes) PlayMovie(m *Movie, mode MovieMode) error {
+	if n.frameCount != 0 {
+		return fmt.Errorf("movies must be played from power-on")
+	}
+	if m.RomChecksum != [16]byte{} && m.RomChecksum != n.cassette.Checksum() {
+		return fmt.Errorf("the movie is recorded with another rom (%s)", m.RomFilename)
+	}
+	n.movie = &moviePlayer{movie: m, mode: mode, desyncFrame: -1}
+	return nil
+}
+
+// SetMovieMode changes the mode of the playing movie.
+func (n *Nes) SetMovieMode(mode MovieMode) {
+	if n.movie != nil {
+		n.movie.mode = mode
+	}
+}
+
+// MovieMode returns the mode of the playing movie.
+func (n *Nes) MovieMode() MovieMode {
+	if n.movie == nil {
+		return MovieReadOnly
+	}
+	return n.movie.mode
+}
+
+// StopMovie stops recording or playing, and returns the movie.
+func (n *Nes) StopMovie() *Movie {
+	if n.movie == nil {
+		return nil
+	}
+	m := n.movie.movie
+	n.movie = nil
+	return m
+}
+
+// IsMovieRecording reports whether the movie is being recorded.
+func (n *Nes) IsMovieRecording() bool {
+	return n.movie != nil && n.movie.isRecording
+}
+
+// IsMoviePlaying reports whether the movie is being played, which ends at the last frame of it.
+func (n *Nes) IsMoviePlaying() bool {
+	return n.movie != nil && !n.movie.isRecording && int(n.frameCount) < len(n.movie.movie.Frames)
+}
+
+// MovieDesync returns the first frame where WRAM differs from the movie.
+func (n *Nes) MovieDesync() (int, bool) {
+	if n.movie == nil || n.movie.desyncFrame < 0 {
+		return 0, false
+	}
+	return n.movie.desyncFrame, true
+}
+
+// FrameCount returns the number of frames since the console is turned on first,
+// which is not cleared by PowerCycle so that the frames of the movie go on.
+func (n *Nes) FrameCount() uint64 {
+	return n.frameCount
+}
+
+func (n *Nes) ramChecksum() uint32 {
+	return crc32.ChecksumIEEE(n.bus.wram.slice(0, 0x800))
+}
+
+// update records the buttons and the commands of the frame, or replaces them with the movie.
+func (p *moviePlayer) update(n *Nes, buttons [4][8]bool, commands byte, isPlayerInput bool) ([4][8]bool, byte) {
+	frame := int(n.frameCount)
+	m := p.movie
+
+	isPlayerInput = isPlayerInput || commands != 0
+	if !p.isRecording && frame < len(m.Frames) && p.mode == MovieReadWrite && isPlayerInput {
+		// rerecord from here
+		m.Frames = m.Frames[:frame]
+		for f := range m.Checksums {
+			if f >= frame {
+				delete(m.Checksums, f)
+			}
+		}
+		m.RerecordCount++
+		p.isRecording = true
+	}
+
+	if frame % movieChecksumInterval == 0 && frame > 0 {
+		sum := n.ramChecksum()
+		if p.isRecording {
+			m.Checksums[frame] = sum
+		} else if expected, ok := m.Checksums[frame]; ok && expected != sum && p.desyncFrame < 0 {
+			p.desyncFrame = frame
+		}
+	}
+
+	if p.isRecording {
+		m.Frames = append(m.Frames, MovieFrame{Commands: commands, Buttons: buttons})
+		return buttons, commands
+	}
+	if frame < len(m.Frames) {
+		return m.Frames[frame].Buttons, m.Frames[frame].Commands
+	}
+	return buttons, commands
+}
@@ -7,26 +7,72 @@ import (
 
 type Nes struct {
 	cassette Ines
+	region   Region
 	cpu      *Cpu
 	ppu      *Ppu
 	bus      *Bus
+	inputs   [4]*padInput
+	movie    *moviePlayer
+	commands byte // MovieSoftReset and MovieHardReset, which are done at the start of the next frame
+	powerOnRam PowerOnRam
+	frameCount uint64 // frames since the first power-on
 }
 
 func NewNes(cassette Ines) *Nes {
+	n := &Nes{
+		cassette: cassette,
+		region:   cassette.Region(),
+	}
+	n.powerOn(NewRenderer())
+	for i := range n.inputs {
+		n.inputs[i] = newPadInput()
+	}
+	n.connectDefaultDevices(cassette.ExpansionDevice())
+	return n
+}
+
+// powerOn makes the memory and the chips in their power-on state.
+func (n *Nes) powerOn(renderer *Renderer) {
 	wram := NewRam(0x800)
-	renderer := NewRenderer()
-	controller := NewController()
-	bus := NewBus(wram, cassette.PrgRom())
+	mapper := newMapper(n.cassette)
+	bus := NewBus(wram, mapper)
 	cpu := NewCpu(bus)
-	ppu := NewPpu(bus, cassette.ChrRom(), renderer, cassette.IsHorizontalMirror())
+	ppu := NewPpu(bus, mapper, renderer, n.region)
+	if observer, ok := mapper.(PpuBusObserver); ok {
+		ppu.observers = append(ppu.observers, observer)
+	}
 	bus.cpu = cpu
 	bus.ppu = ppu
-	bus.controller = controller
-	return &Nes{
-		cassette: cassette,
-		cpu:      cpu,
-		ppu:      ppu,
-		bus:      bus,
+	n.cpu = cpu
+	n.ppu = ppu
+	n.bus = bus
+	n.fillRam()
+}
+
+// connectDefaultDevices connects the devices which the cassette expects,
+// or the standard controllers to both ports.
+func (n *Nes) connectDefaultDevices(expansion byte) {
+	n.ConnectInputDevice(Port1, NewController())
+	n.ConnectInputDevice(Port2, NewController())
+
+	switch expansion {
+	case ExpansionFourScore:
+		n.ConnectFourPlayerAdapter(NewFourScore())
+	case ExpansionFamicom4P:
+		n.ConnectFourPlayerAdapter(NewFamicomFourPlayerAdapter())
+	case ExpansionZapper:
+		n.ConnectInputDevice(Port2, NewZapper())
+	case ExpansionTwoZappers:
+		n.ConnectInputDevice(Port1, NewZapper())
+		n.ConnectInputDevice(Port2, NewZapper())
+	case ExpansionPowerPadA, ExpansionPowerPadB:
+		n.ConnectInputDevice(Port2, NewPowerPad())
+	case ExpansionVaus:
+		n.ConnectInputDevice(Port2, NewVaus())
+	case ExpansionFamicomVaus:
+		n.ConnectExpansionDevice(NewVaus())
+	case ExpansionFamilyKeyboard:
+		n.ConnectExpansionDevice(NewFamilyKeyboard())
 	}
 }
 
@@ -45,47 +91,170 @@ func (n *Nes) Init() error {
 	return nil
 }
 
+// Reset pushes the reset button at the start of the next frame, which is recorded in the movie.
+// The cpu starts from the reset vector and the ppu registers are cleared, but the memory is kept.
+func (n *Nes) Reset() {
+	n.commands |= MovieSoftReset
+}
+
+// PowerCycle turns the power off and on at the start of the next frame, which is recorded in the movie.
+// The memory and the chips are initialized, but the connected devices and the settings are kept.
+func (n *Nes) PowerCycle() {
+	n.commands |= MovieHardReset
+}
+
+// doCommands does the reset commands of the frame.
+func (n *Nes) doCommands(commands byte) {
+	if commands & MovieHardReset != 0 {
+		n.powerCycle()
+	} else if commands & MovieSoftReset != 0 {
+		n.ppu.reset()
+		n.cpu.interruptReset()
+	}
+}
+
+func (n *Nes) powerCycle() {
+	old := n.bus
+	var observers []PpuBusObserver
+	for _, o := range n.ppu.observers {
+		if m, ok := o.(Mapper); ok && m == old.mapper {
+			// the new mapper is added by powerOn
+			continue
+		}
+		observers = append(observers, o)
+	}
+
+	n.powerOn(n.ppu.renderer)
+	n.ppu.observers = append(n.ppu.observers, observers...)
+	for port, d := range old.ports {
+		n.ConnectInputDevice(port, d)
+	}
+	n.ConnectExpansionDevice(old.expansion)
+	n.Init()
+}
+
 func (n *Nes) Run(){
+	n.updateInputs()
 
 	for !n.step(){
 	}
+	n.frameCount++
 }
 
 func (n *Nes) step() bool {
 
 	// check interrupt
-	if n.cpu.intrrupt != nil {
-		n.cpu.intrrupt()
-	}
-	n.cpu.intrrupt = nil
+	n.cpu.handleInterrupt()
 
 	pc := n.cpu.PC
 
 	// decode
 	b := n.bus.Load(pc)
 	inst := n.cpu.decode(b)
-	cycle := inst.cycle
 	addr := n.cpu.solveAddrMode(inst.addrMode)
+	cycle := n.cpu.cycles(inst)
 
 	// for debug
 	// n.cpu.dump(b, addr, inst.mnemonic, inst.addrMode)
 
 	n.cpu.advance(inst.addrMode)
+	// The operand is accessed in the last cycle of the instruction.
+	n.cpu.accessCycle = n.cpu.cycle + cycle - 1
 	n.cpu.execute(inst, addr)
-	n.cpu.cycle += cycle
-
-	if n.ppu.run(cycle){
-		n.ppu.renderer.render(n.ppu.PpuMask, n.ppu.isBackgroundEnable(), n.ppu.isSpriteEnable())
-		return true
-	}
+	n.cpu.cycle += cycle + n.cpu.stall
+	n.cpu.stall = 0
 
-	return false
+	n.ppu.run(n.cpu.cycle)
+	return n.ppu.hasFrameEnded()
 }
 
 func (n *Nes) Buffer() *image.RGBA {
 	return n.ppu.renderer.Buffer()
 }
 
-func (n *Nes) PushButton(b [8]bool) {
-	n.bus.controller.SetButton(b)
-}
\ No newline at end of file
+// Ram returns a copy of WRAM ($0000 - $07FF).
+func (n *Nes) Ram() []byte {
+	return append([]byte{}, n.bus.wram.slice(0, 0x800)...)
+}
+
+// PushButton sets the buttons of the player (0 - 3), which are sent to the controller from the next frame.
+// Players 1 and 2 are the controllers on Port1 and Port2, and players 3 and 4 are on
+// the four player adapter. It does nothing if the player has no controller.
+func (n *Nes) PushButton(player int, b [8]bool) {
+	n.inputs[player].held = b
+}
+
+func (n *Nes) pad(player int) *Controller {
+	if player < 2 {
+		if c, ok := n.bus.ports[player].(*Controller); ok {
+			return c
+		}
+	}
+	for _, d := range n.bus.ports {
+		if p, ok := d.(*fourPlayerPort); ok {
+			return p.adapter.Pad(player)
+		}
+	}
+	return nil
+}
+
+// ConnectInputDevice connects the device to the port (Port1 or Port2).
+// nil disconnects the port.
+func (n *Nes) ConnectInputDevice(port int, d InputDevice) {
+	if s, ok := d.(lightSensor); ok {
+		s.attachPpu(n.ppu)
+	}
+	n.bus.ports[port] = d
+}
+
+// ConnectFourPlayerAdapter connects the adapter to both ports.
+func (n *Nes) ConnectFourPlayerAdapter(a *FourPlayerAdapter) {
+	n.ConnectInputDevice(Port1, a.Port(Port1))
+	n.ConnectInputDevice(Port2, a.Port(Port2))
+}
+
+// ConnectExpansionDevice connects the device to the expansion port of Famicom.
+// nil disconnects the port.
+func (n *Nes) ConnectExpansionDevice(d ExpansionDevice) {
+	n.bus.expansion = d
+}
+
+// ExpansionDevice returns the device connected to the expansion port.
+func (n *Nes) ExpansionDevice() ExpansionDevice {
+	return n.bus.expansion
+}
+
+// InputDevice returns the device connected to the port.
+func (n *Nes) InputDevice(port int) InputDevice {
+	return n.bus.ports[port]
+}
+
+// SetPalette replaces the system palette, e.g. by LoadPalette or GeneratePalette.
+func (n *Nes) SetPalette(p *Palette) {
+	n.ppu.renderer.palettes = *p
+}
+
+// SetNtscFilter enables the ntsc composite video filter, which makes Buffer NtscWidth wide.
+// nil disables it.
+func (n *Nes) SetNtscFilter(params *NtscParams) {
+	if params == nil {
+		n.ppu.renderer.filter = nil
+		return
+	}
+	n.ppu.renderer.filter = NewNtscFilter(*params)
+}
+
+func (n *Nes) Region() Region {
+	return n.region
+}
+
+// SetRegion overrides the region detected from the cassette.
+func (n *Nes) SetRegion(r Region) {
+	n.region = r
+	n.ppu.timing = r.timing()
+}
+
+// AddPpuBusObserver registers the observer of the ppu address bus.
+func (n *Nes) AddPpuBusObserver(o PpuBusObserver) {
+	n.ppu.observers = append(n.ppu.observers, o)
+}
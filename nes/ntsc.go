@@ -0,0 +1,188 @@
+package nes
+
+import (
+	"image"
+	"math"
+)
+
+// Voltage levels of the composite video signal, relative to sync.
+const (
+	ntscBlack       = 0.518
+	ntscWhite       = 1.962
+	ntscAttenuation = 0.746
+)
+
+var ntscLevels = [8]float64{
+	0.350, 0.518, 0.962, 1.550, // signal low
+	1.094, 1.506, 1.962, 1.962, // signal high
+}
+
+// isInColorPhase reports whether the square wave of the color is high at the phase (0 - 11).
+func isInColorPhase(color int, phase int) bool{
+	return (color + phase) % 12 < 6
+}
+
+// ntscSignal returns the voltage which the ppu outputs for the pixel at the phase.
+// pixel is "eeellcccc": emphasis(3bit), level(2bit) and color(4bit).
+func ntscSignal(pixel int, phase int) float64{
+	color := pixel & 0x0F
+	level := (pixel >> 4) & 0x03
+	emphasis := pixel >> 6
+	if color > 13 {
+		// colors $xE - $xF are always black.
+		level = 1
+	}
+
+	low := ntscLevels[level]
+	high := ntscLevels[4 + level]
+	if color == 0 {
+		// only high level is emitted
+		low = high
+	}
+	if color > 12 {
+		// only low level is emitted
+		high = low
+	}
+
+	signal := low
+	if isInColorPhase(color, phase) {
+		signal = high
+	}
+
+	// emphasis attenuates the signal while the phase is in the emphasized color.
+	if (emphasis & 0x01 != 0 && isInColorPhase(0, phase)) ||
+		(emphasis & 0x02 != 0 && isInColorPhase(4, phase)) ||
+		(emphasis & 0x04 != 0 && isInColorPhase(8, phase)) {
+		signal *= ntscAttenuation
+	}
+
+	return signal
+}
+
+// normalizeNtscSignal maps the voltage to 0.0 (black) - 1.0 (white).
+func normalizeNtscSignal(signal float64) float64{
+	return (signal - ntscBlack) / (ntscWhite - ntscBlack)
+}
+
+var ntscCos, ntscSin [12]float64
+
+func init() {
+	for phase := 0; phase < 12; phase++ {
+		ntscCos[phase] = math.Cos(math.Pi * float64(phase) / 6)
+		ntscSin[phase] = math.Sin(math.Pi * float64(phase) / 6)
+	}
+}
+
+// ntscHue returns the rotation from the demodulated chroma to U/V axis.
+func ntscHue(params NtscParams) (float64, float64){
+	// The color burst is in phase with color 8, which is at 180 degree of U axis.
+	hue := math.Pi / 12 + params.Hue * math.Pi / 180
+	return math.Cos(hue), math.Sin(hue)
+}
+
+// ntscChroma rotates the demodulated chroma to U/V by the hue, and applies the saturation.
+func ntscChroma(i, q float64, hueCos, hueSin float64, saturation float64) (float64, float64){
+	u := (i * hueCos + q * hueSin) * saturation
+	v := (i * hueSin - q * hueCos) * saturation
+	return u, v
+}
+
+// Each pixel lasts 8 phases of the 12 phases of the color subcarrier.
+const ntscSamplesPerPixel = 8
+
+// NtscWidth is the width of the image filtered by NtscFilter (2 samples per pixel).
+const NtscWidth = 512
+
+// ntscFilterPadding is the samples added to both sides of a line for the decoding window.
+const ntscFilterPadding = 6
+
+// gammaTableSize is the resolution of the gamma correction table of NtscFilter.
+const gammaTableSize = 1024
+
+// NtscFilter re-encodes the raw pixels to the composite video signal and decodes it again,
+// which reproduces the artifacts like chroma/luma crosstalk and dot crawl.
+type NtscFilter struct {
+	params     NtscParams
+	hueCos     float64
+	hueSin     float64
+	signals    [512][12]float64 // normalized signal of each pixel ("eeellcccc") and phase
+	gammaTable [gammaTableSize + 1]byte
+
+	// prefix sums of the luma and the demodulated chroma of a line
+	sumY [256 * ntscSamplesPerPixel + ntscFilterPadding * 2 + 1]float64
+	sumI [256 * ntscSamplesPerPixel + ntscFilterPadding * 2 + 1]float64
+	sumQ [256 * ntscSamplesPerPixel + ntscFilterPadding * 2 + 1]float64
+	img  *image.RGBA
+}
+
+func NewNtscFilter(params NtscParams) *NtscFilter{
+	f := &NtscFilter{
+		params: params,
+		img:    image.NewRGBA(image.Rect(0, 0, NtscWidth, 240)),
+	}
+
+	for pixel := 0; pixel < 512; pixel++ {
+		for phase := 0; phase < 12; phase++ {
+			signal := normalizeNtscSignal(ntscSignal(pixel, phase))
+			f.signals[pixel][phase] = signal * params.Contrast + params.Brightness
+		}
+	}
+
+	f.hueCos, f.hueSin = ntscHue(params)
+	for i := range f.gammaTable {
+		f.gammaTable[i] = gammaCorrect(float64(i) / gammaTableSize, params.Gamma)
+	}
+	return f
+}
+
+// apply filters the frame. pixels are "eeellcccc" and linePhases are the phases where each line starts.
+func (f *NtscFilter) apply(pixels []uint16, linePhases []int) *image.RGBA{
+	samples := 256 * ntscSamplesPerPixel
+	step := samples / NtscWidth
+
+	for y := 0; y < 240; y++ {
+		phase := linePhases[y]
+		for k := -ntscFilterPadding; k < samples + ntscFilterPadding; k++ {
+			x := clamp(k / ntscSamplesPerPixel, 0, 255)
+			p := (phase + k + 12) % 12
+			s := f.signals[pixels[y * 256 + x]][p]
+
+			n := k + ntscFilterPadding
+			f.sumY[n + 1] = f.sumY[n] + s
+			f.sumI[n + 1] = f.sumI[n] + s * ntscCos[p]
+			f.sumQ[n + 1] = f.sumQ[n] + s * ntscSin[p]
+		}
+
+		for x := 0; x < NtscWidth; x++ {
+			// decode with the window of one subcarrier cycle around the sample.
+			begin := x * step + step / 2 - 6 + ntscFilterPadding
+			end := begin + 12
+			luma := (f.sumY[end] - f.sumY[begin]) / 12
+			i := (f.sumI[end] - f.sumI[begin]) / 6
+			q := (f.sumQ[end] - f.sumQ[begin]) / 6
+
+			u, v := ntscChroma(i, q, f.hueCos, f.hueSin, f.params.Saturation)
+			r, g, b := yuvToRGB(luma, u, v)
+			pix := f.img.Pix[f.img.PixOffset(x, y):]
+			pix[0] = f.gamma(r)
+			pix[1] = f.gamma(g)
+			pix[2] = f.gamma(b)
+			pix[3] = 0xFF
+		}
+	}
+	return f.img
+}
+
+func (f *NtscFilter) gamma(v float64) byte{
+	return f.gammaTable[clamp(int(v * gammaTableSize + 0.5), 0, gammaTableSize)]
+}
+
+func clamp(v, min, max int) int{
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,150 @@
+package nes
+
+import (
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"math"
+)
+
+// Palette is the system palette for all 8 combinations of the emphasis bits ($2001 bit5-7).
+type Palette [8][64]color.RGBA
+
+// emphasisAttenuation is the ratio applied to the channels which are not emphasized.
+const emphasisAttenuation = 0.816328
+
+// newEmphasisPalettes builds the palettes for all 8 combinations of the emphasis bits.
+// Each set bit keeps its own channel and dims the other two.
+func newEmphasisPalettes(base [64]color.RGBA) Palette{
+	var palettes Palette
+	for emphasis := 0; emphasis < 8; emphasis++ {
+		r, g, b := 1.0, 1.0, 1.0
+		if emphasis & 0x01 != 0 {
+			// red
+			g *= emphasisAttenuation
+			b *= emphasisAttenuation
+		}
+		if emphasis & 0x02 != 0 {
+			// green
+			r *= emphasisAttenuation
+			b *= emphasisAttenuation
+		}
+		if emphasis & 0x04 != 0 {
+			// blue
+			r *= emphasisAttenuation
+			g *= emphasisAttenuation
+		}
+
+		for i, c := range base {
+			palettes[emphasis][i] = color.RGBA{
+				R: byte(float64(c.R) * r),
+				G: byte(float64(c.G) * g),
+				B: byte(float64(c.B) * b),
+				A: 0xFF,
+			}
+		}
+	}
+	return palettes
+}
+
+// LoadPalette reads a .pal file, which has 64 colors (192 bytes)
+// or 512 colors including the emphasis (1536 bytes).
+func LoadPalette(path string) (*Palette, error){
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil{
+		return nil, fmt.Errorf("cannot open %s: %v", path, err)
+	}
+
+	var colors []color.RGBA
+	for i := 0; i + 2 < len(bytes); i += 3 {
+		colors = append(colors, color.RGBA{R: bytes[i], G: bytes[i+1], B: bytes[i+2], A: 0xFF})
+	}
+
+	switch len(bytes) {
+	case 64 * 3:
+		var base [64]color.RGBA
+		copy(base[:], colors)
+		palette := newEmphasisPalettes(base)
+		return &palette, nil
+	case 512 * 3:
+		var palette Palette
+		for i, c := range colors {
+			palette[i / 64][i % 64] = c
+		}
+		return &palette, nil
+	}
+
+	return nil, fmt.Errorf("invalid palette size %d bytes, expected 192 or 1536 bytes. [PATH] %s", len(bytes), path)
+}
+
+// NtscParams are the parameters of the ntsc palette generator.
+type NtscParams struct {
+	Hue        float64 // degree
+	Saturation float64
+	Contrast   float64
+	Brightness float64
+	Gamma      float64 // gamma of the reference display
+}
+
+var DefaultNtscParams = NtscParams{
+	Hue:        0.0,
+	Saturation: 1.0,
+	Contrast:   1.0,
+	Brightness: 0.0,
+	Gamma:      2.2,
+}
+
+// GeneratePalette computes the palette by decoding the composite video signal of each color.
+func GeneratePalette(params NtscParams) *Palette{
+	var palette Palette
+	for pixel := 0; pixel < 512; pixel++ {
+		y, u, v := ntscDecode(pixel, params)
+		palette[pixel / 64][pixel % 64] = yuvToRGBA(y, u, v, params.Gamma)
+	}
+	return &palette
+}
+
+// ntscDecode samples the 12 phases of the color subcarrier and separates the luma and chroma.
+func ntscDecode(pixel int, params NtscParams) (float64, float64, float64){
+	var y, i, q float64
+	for phase := 0; phase < 12; phase++ {
+		signal := normalizeNtscSignal(ntscSignal(pixel, phase))
+		signal = signal * params.Contrast + params.Brightness
+		y += signal
+		i += signal * ntscCos[phase]
+		q += signal * ntscSin[phase]
+	}
+
+	// The demodulated chroma is the half of its amplitude.
+	hueCos, hueSin := ntscHue(params)
+	u, v := ntscChroma(i / 6, q / 6, hueCos, hueSin, params.Saturation)
+	return y / 12, u, v
+}
+
+func yuvToRGB(y, u, v float64) (float64, float64, float64){
+	r := y + 1.139883 * v
+	g := y - 0.394642 * u - 0.580622 * v
+	b := y + 2.032062 * u
+	return r, g, b
+}
+
+func yuvToRGBA(y, u, v float64, gamma float64) color.RGBA{
+	r, g, b := yuvToRGB(y, u, v)
+	return color.RGBA{
+		R: gammaCorrect(r, gamma),
+		G: gammaCorrect(g, gamma),
+		B: gammaCorrect(b, gamma),
+		A: 0xFF,
+	}
+}
+
+// gammaCorrect converts the value for the reference display to sRGB (gamma 2.2).
+func gammaCorrect(value float64, gamma float64) byte{
+	if value <= 0 {
+		return 0
+	}
+	if value >= 1 {
+		return 0xFF
+	}
+	return byte(math.Pow(value, gamma / 2.2) * 0xFF + 0.5)
+}
@@ -0,0 +1,57 @@
+package nes
+
+// powerPadBits are the buttons (1 - 12) which are shifted out in bit 3 and bit 4.
+// Bit 4 has only 4 buttons, and returns 1 after them.
+var powerPadBits = [2][8]int{
+	{2, 1, 5, 9, 6, 10, 11, 7},
+	{4, 3, 12, 8, 0, 0, 0, 0},
+}
+
+// PowerPad is the mat with 12 buttons in 3 rows of 4, which is usually connected to port 2.
+// Side A and side B differ only in the numbers printed on the mat.
+type PowerPad struct {
+	buttons [12]bool // buttons 1 - 12
+	reset   byte
+	counter int
+}
+
+func NewPowerPad() *PowerPad{
+	return &PowerPad{}
+}
+
+// SetButton sets the buttons 1 - 12, which are numbered from the top left of side B.
+func (p *PowerPad) SetButton(b [12]bool){
+	p.buttons = b
+}
+
+func (p *PowerPad) Write(b byte){
+	p.reset = b
+	if p.reset & 1 == 1 {
+		p.counter = 0
+	}
+}
+
+func (p *PowerPad) bit(line int) byte{
+	if p.counter >= 8 {
+		return 1
+	}
+	button := powerPadBits[line][p.counter]
+	if button == 0 {
+		return 1
+	}
+	if p.buttons[button - 1] {
+		return 1
+	}
+	return 0
+}
+
+// Read returns the serial data in bit 3 and bit 4.
+func (p *PowerPad) Read() byte{
+	b := p.bit(0) << 3 | p.bit(1) << 4
+
+	p.counter++
+	if p.reset & 1 == 1 {
+		p.counter = 0
+	}
+	return b
+}
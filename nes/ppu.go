@@ -1,9 +1,5 @@
 package nes
 
-import (
-	"image/color"
-)
-
 type Ppu struct {
 	// Core
 	PpuCtrl     byte   // 0x2000
@@ -11,44 +7,84 @@ type Ppu struct {
 	PpuStatus   byte   // 0x2002
 	OamAddr     byte   // 0x2003
 	OamData     byte   // 0x2004
-	scrollFirst bool   // for 0x2005
-	PpuScrollX  byte   // 0x2005(1)
-	PpuScrollY  byte   // 0x2005(2)
-	PpuAddr     word   // 0x2006
-	isLowerAddr bool   // for 0x2006
 	PpuData     byte   // 0x2007
-	cycle       uint64
+	cycle       int    // dot (0 - 340)
+	line        int    // scanline (0 - 261 in NTSC, 0 - 311 in PAL/Dendy)
+	frame       uint64
+	timing      regionTiming
+	clock       int    // master clocks which are not consumed yet
+	cpuCycle    uint64 // cpu cycles which the ppu has caught up with
+	isFrameEnd  bool
+	isVblankSuppressed bool // $2002 was read just before vblank starts
+	isResetting bool // $2000, $2001, $2005 and $2006 ignore writes until the end of vblank after reset
+	phase       int    // color subcarrier phase (0 - 11) where the frame starts
 	vram        Mem
+	palette     Mem
 	bus         *Bus
 	renderer    *Renderer
+	observers   []PpuBusObserver
+
+	// Internal registers
+	v word // current vram address (15bit)
+	t word // temporary vram address (15bit)
+	x byte // fine x scroll (3bit)
+	w bool // write toggle for 0x2005/0x2006
+
+	// Background
+	nameTableByte byte
+	attributeByte byte
+	lowTileByte   byte
+	highTileByte  byte
+	tileData      uint64
+
+	// I/O latch of the ppu data bus, whose bits decay to 0 unless they are refreshed.
+	latch          byte
+	latchRefreshed [8]uint64 // frame when each bit was refreshed to 1
 
 	// Sprite RAM
-	spriteBuffer [64]*Sprite
-	spriteRam Mem
-	vramBuf byte
+	sprites     [8]*Sprite
+	spriteCount int
+	spriteRam   Mem
+	spriteLowByte byte
+	vramBuf     byte
 }
 
-func NewPpu(bus *Bus, chrRom []byte, r *Renderer, isHorizontalMirror bool) *Ppu{
+func NewPpu(bus *Bus, mapper Mapper, r *Renderer, region Region) *Ppu{
+	palette := NewPaletteRam()
 	return &Ppu{
 		PpuCtrl:            0x00,
 		PpuMask:            0x00,
 		PpuStatus:          0x00,
 		OamAddr:            0,
 		OamData:            0,
-		scrollFirst:        true,
-		PpuScrollX:         0,
-		PpuScrollY:         0,
-		PpuAddr:            0x00,
 		PpuData:            0x00,
 		cycle:              0,
-		vram:               NewVRamInit(0x4000, chrRom, isHorizontalMirror),
+		line:               0,
+		timing:             region.timing(),
+		vram:               NewVRam(mapper, palette),
+		palette:            palette,
 		bus:                bus,
 		renderer:           r,
-		spriteBuffer:       [64]*Sprite{},
 		spriteRam:          NewRam(0x100),
 	}
 }
 
+// reset is done by the reset button of NES, which clears the registers but keeps vram and oam.
+func (p *Ppu) reset(){
+	p.PpuCtrl = 0x00
+	p.PpuMask = 0x00
+	p.w = false
+	p.t = 0
+	p.x = 0
+	p.vramBuf = 0
+	p.isResetting = true
+}
+
+// isIgnoringWrite reports whether the register ignores writes after reset.
+func (p *Ppu) isIgnoringWrite(addr word) bool{
+	return p.isResetting && (addr == 0x2000 || addr == 0x2001 || addr == 0x2005 || addr == 0x2006)
+}
+
 func (p *Ppu) getIncrementCount() word{
 	if p.PpuCtrl & 0x04 != 0{
 		return 32
@@ -59,7 +95,19 @@ func (p *Ppu) getIncrementCount() word{
 
 // $0x2000
 func (p *Ppu) writePpuCtrl(b byte){
+	wasAbleNmi := p.isAbleNmiVblank()
 	p.PpuCtrl = b
+
+	if !wasAbleNmi && p.isAbleNmiVblank() && p.PpuStatus & 0x80 != 0 {
+		// Enabling nmi while in vblank raises nmi immediately.
+		p.raiseNmi()
+	} else if wasAbleNmi && !p.isAbleNmiVblank() && p.isJustEnteredVblank() {
+		// Disabling nmi just after vblank starts suppresses it.
+		p.bus.cpu.cancelNmi()
+	}
+
+	// t: ...BA.. ........ = d: ......BA
+	p.t = (p.t & 0xF3FF) | (word(b & 0x03) << 10)
 }
 
 // $0x2001
@@ -69,12 +117,29 @@ func (p *Ppu) writePpuMask(b byte){
 
 // 0x2002
 func (p *Ppu) readPpuStatus() byte{
-	p.scrollFirst = true // reset scroll register($0x2006)
-	b := p.PpuStatus
+	p.w = false // reset write toggle($0x2005, $0x2006)
+
+	if p.line == p.timing.vblankLine && p.cycle == 1 {
+		// Reading one clock before vblank starts reads it as clear,
+		// and suppresses both the flag and nmi for this frame.
+		p.isVblankSuppressed = true
+	} else if p.isJustEnteredVblank() {
+		// Reading on the same clock or one later reads it as set, but suppresses nmi.
+		p.bus.cpu.cancelNmi()
+	}
+
+	// bit 0-4 are not driven, so they return the latch.
+	b := p.PpuStatus & 0xE0 | p.readLatch() & 0x1F
+	p.refreshLatch(b, 0xE0)
 	p.clearVblank()
 	return b
 }
 
+// isJustEnteredVblank reports whether vblank started within the last 2 dots.
+func (p *Ppu) isJustEnteredVblank() bool{
+	return p.line == p.timing.vblankLine && (p.cycle == 2 || p.cycle == 3)
+}
+
 // $0x2003
 func (p *Ppu) writeOamAddr(b byte){
 	p.OamAddr = b
@@ -82,7 +147,13 @@ func (p *Ppu) writeOamAddr(b byte){
 
 // $0x2004
 func (p *Ppu) readOamData() byte{
-	return p.spriteRam.load(word(p.OamAddr))
+	b := p.spriteRam.load(word(p.OamAddr))
+	if p.OamAddr & 0x03 == 2 {
+		// bit 2-4 of sprite attributes are unimplemented, and read back as 0.
+		b &= 0xE3
+	}
+	p.refreshLatch(b, 0xFF)
+	return b
 }
 
 func (p *Ppu) writeOamData(b byte){
@@ -92,46 +163,103 @@ func (p *Ppu) writeOamData(b byte){
 
 // $0x2005
 func (p *Ppu) writePpuScroll(b byte){
-	if p.scrollFirst {
-		p.PpuScrollX = b
+	if !p.w {
+		// t: ....... ...HGFED = d: HGFED...
+		// x:              CBA = d: .....CBA
+		p.t = (p.t & 0xFFE0) | word(b >> 3)
+		p.x = b & 0x07
 	} else{
-		p.PpuScrollY = b
+		// t: CBA..HG FED..... = d: HGFEDCBA
+		p.t = (p.t & 0x8FFF) | (word(b & 0x07) << 12)
+		p.t = (p.t & 0xFC1F) | (word(b & 0xF8) << 2)
 	}
 
-	p.scrollFirst = !p.scrollFirst
+	p.w = !p.w
 }
 
 // $0x2006
 func (p *Ppu) writePpuAddr(b byte){
-	if p.isLowerAddr{
-		p.PpuAddr += word(b)
-		p.isLowerAddr = false
+	if p.w{
+		// t: ....... HGFEDCBA = d: HGFEDCBA
+		// v                   = t
+		p.t = (p.t & 0xFF00) | word(b)
+		p.v = p.t
 	}else{
-		p.PpuAddr = word(b) << 8
-		p.isLowerAddr = true
+		// t: .FEDCBA ........ = d: ..FEDCBA
+		p.t = (p.t & 0x80FF) | (word(b & 0x3F) << 8)
 	}
+
+	p.w = !p.w
 }
 
 // $0x2007
 func (p *Ppu) readPpuData() byte{
-	if p.PpuAddr >= 0x3F00 {
-		b := p.vram.load(p.PpuAddr)
-		p.vramBuf = p.vram.load(p.PpuAddr - 0x1000)
-		p.PpuAddr += p.getIncrementCount()
+	addr := p.v & 0x3FFF
+	if addr >= 0x3F00 {
+		// palette is 6 bits, and the upper 2 bits return the latch.
+		b := p.vram.load(addr) & 0x3F | p.readLatch() & 0xC0
+		p.refreshLatch(b, 0x3F)
+		// palette is inside the ppu, so the cartridge sees the nametable under it.
+		p.vramBuf = p.fetch(addr - 0x1000)
+		p.v += p.getIncrementCount()
 		return b
 	}
 
 	// emulate buf delay
 	b := p.vramBuf
-	p.vramBuf = p.vram.load(p.PpuAddr)
-	p.PpuAddr += p.getIncrementCount()
+	p.refreshLatch(b, 0xFF)
+	p.vramBuf = p.fetch(addr)
+	p.v += p.getIncrementCount()
 	return b
 }
 
+// latchDecayFrames is how long the bits of the latch keep 1 (about 600ms).
+const latchDecayFrames = 36
+
+// refreshLatch drives the bits of mask in the latch to b.
+func (p *Ppu) refreshLatch(b byte, mask byte){
+	p.latch = p.latch & ^mask | b & mask
+	for i := uint(0); i < 8; i++ {
+		if (b & mask) >> i & 0x01 != 0 {
+			p.latchRefreshed[i] = p.frame
+		}
+	}
+}
+
+func (p *Ppu) readLatch() byte{
+	for i := uint(0); i < 8; i++ {
+		if p.frame - p.latchRefreshed[i] > latchDecayFrames {
+			p.latch &= ^(0x01 << i)
+		}
+	}
+	return p.latch
+}
+
 func (p *Ppu) writePpuData(b byte){
-	addr := p.PpuAddr
+	addr := p.v & 0x3FFF
 	p.vram.store(addr, b)
-	p.PpuAddr += p.getIncrementCount()
+	p.notifyObservers(addr)
+	p.v += p.getIncrementCount()
+}
+
+// PpuBusObserver sees every address which the ppu puts on its bus,
+// in the same order as the hardware does (e.g. MMC2/MMC4 latches on tiles $FD/$FE).
+// ObservePpuBus is called after the data is read.
+type PpuBusObserver interface {
+	ObservePpuBus(addr uint16)
+}
+
+// fetch reads vram through the ppu bus, which the observers can see.
+func (p *Ppu) fetch(addr word) byte{
+	b := p.vram.load(addr)
+	p.notifyObservers(addr)
+	return b
+}
+
+func (p *Ppu) notifyObservers(addr word){
+	for _, o := range p.observers {
+		o.ObservePpuBus(uint16(addr))
+	}
 }
 
 func (p *Ppu) setVblank(){
@@ -143,18 +271,27 @@ func (p *Ppu) clearVblank(){
 }
 
 func (p *Ppu) enterVblank(){
+	if p.isVblankSuppressed {
+		p.isVblankSuppressed = false
+		return
+	}
+
 	p.setVblank()
 	if p.isAbleNmiVblank(){
-		p.bus.cpu.InterruptNmi()
+		p.raiseNmi()
 	}
 }
 
+func (p *Ppu) raiseNmi(){
+	p.bus.cpu.InterruptNmi()
+	p.bus.cpu.interruptCycle = p.cpuCycle
+}
+
 func (p *Ppu) leaveVblank() {
-	p.renderer.sprites = p.spriteBuffer
-	p.renderer.backgroundPalette = p.getBackgroundPalette()
-	p.renderer.spritePalette = p.getSpritePalette()
-	p.renderer.line = 0
+	p.isResetting = false
 	p.clearVblank()
+	p.noHitSprite()
+	p.clearSpriteOverflow()
 	p.bus.cpu.unsetBit(Irq)
 }
 
@@ -170,6 +307,18 @@ func (p *Ppu) isSpriteEnable() bool {
 	return p.PpuMask & 0x10 != 0
 }
 
+func (p *Ppu) isRenderingEnable() bool {
+	return p.isBackgroundEnable() || p.isSpriteEnable()
+}
+
+func (p *Ppu) isBackgroundClipped() bool {
+	return p.PpuMask & 0x02 == 0
+}
+
+func (p *Ppu) isSpriteClipped() bool {
+	return p.PpuMask & 0x04 == 0
+}
+
 func (p *Ppu) hitSprite(){
 	p.PpuStatus |= 0x40
 }
@@ -178,44 +327,229 @@ func (p *Ppu) noHitSprite(){
 	p.PpuStatus &= 0xBF
 }
 
-func (p *Ppu) hasHitSprite() bool{
-	zeroSpriteY := p.spriteRam.load(0) + 8
-	return p.renderer.line == int(zeroSpriteY) && p.isBackgroundEnable() && p.isSpriteEnable()
+func (p *Ppu) setSpriteOverflow(){
+	p.PpuStatus |= 0x20
+}
+
+func (p *Ppu) clearSpriteOverflow(){
+	p.PpuStatus &= 0xDF
+}
+
+// hasHitSprite reports whether an opaque pixel of sprite 0 overlaps
+// an opaque background pixel at dot x.
+func (p *Ppu) hasHitSprite(x int, bg byte, sprite *Sprite, spriteColor byte) bool{
+	if sprite.index != 0 || bg % 4 == 0 || spriteColor % 4 == 0 {
+		return false
+	}
+
+	// The hit never happens at x=255, because of an obscure pipeline quirk.
+	if x == 255 {
+		return false
+	}
+
+	return true
+}
+
+// run catches up with the given cpu cycle. It is called before the cpu accesses the ppu registers
+// and after each instruction, so that the registers are read and written at the right dot.
+// Both are driven by the master clock, e.g. 3 dots per cpu cycle in NTSC and 3.2 dots in PAL.
+func (p *Ppu) run(cpuCycle uint64){
+	for p.cpuCycle < cpuCycle {
+		p.cpuCycle++
+		p.clock += p.timing.cpuClockDivider
+		for p.clock >= p.timing.ppuClockDivider {
+			p.clock -= p.timing.ppuClockDivider
+			p.step()
+		}
+	}
+}
+
+// hasFrameEnded reports whether a frame has been completed since the last call.
+func (p *Ppu) hasFrameEnded() bool{
+	isFrameEnd := p.isFrameEnd
+	p.isFrameEnd = false
+	return isFrameEnd
 }
 
-func (p *Ppu) run(cycle uint64) bool{
-	p.cycle+= cycle * 3
+func (p *Ppu) isOddFrameSkipped() bool{
+	return p.timing.isOddFrameSkip && p.isRenderingEnable() && p.frame % 2 == 1
+}
 
-	if p.renderer.line == 0{
-		p.buildSprites()
+func (p *Ppu) preRenderLine() int{
+	return p.timing.lines - 1
+}
+
+// step runs a single dot.
+func (p *Ppu) step(){
+	isVisibleLine := p.line < 240
+	isPreRenderLine := p.line == p.preRenderLine()
+	isRenderLine := isVisibleLine || isPreRenderLine
+	isPrefetchCycle := p.cycle >= 321 && p.cycle <= 336
+	isVisibleCycle := p.cycle >= 1 && p.cycle <= 256
+	isFetchCycle := isPrefetchCycle || isVisibleCycle
+
+	if isVisibleLine && isVisibleCycle {
+		p.renderPixel()
 	}
 
-	if p.cycle >= 341 {
-		p.cycle -= 341
-		p.renderer.line++
+	if p.isRenderingEnable() {
+		if isRenderLine && isFetchCycle {
+			p.fetchBackground()
+		}
+
+		if isRenderLine && (p.cycle == 337 || p.cycle == 339) {
+			// garbage nametable fetches at the end of the line
+			p.fetch(0x2000 | (p.v & 0x0FFF))
+		}
+
+		if isPreRenderLine && p.cycle >= 280 && p.cycle <= 304 {
+			p.copyY()
+		}
 
-		// 0爆弾
-		if p.hasHitSprite(){
+		if isRenderLine {
+			if isFetchCycle && p.cycle % 8 == 0 {
+				p.incrementX()
+			}
+			if p.cycle == 256 {
+				p.incrementY()
+			}
+			if p.cycle == 257 {
+				p.copyX()
+			}
+		}
+
+		if p.cycle == 257 {
+			if isVisibleLine {
+				p.evaluateSprites()
+			} else {
+				p.spriteCount = 0
+			}
+		}
+
+		if isRenderLine && p.cycle >= 257 && p.cycle <= 320 {
+			p.fetchSprite()
+		}
+	}
+
+	if p.line == p.timing.vblankLine && p.cycle == 1 {
+		p.enterVblank()
+		p.isFrameEnd = true
+	}
+
+	if isPreRenderLine && p.cycle == 1 {
+		p.leaveVblank()
+	}
+
+	p.cycle++
+	if isPreRenderLine && p.cycle == 340 && p.isOddFrameSkipped() {
+		// The last dot of the pre-render line is skipped in odd frames while rendering,
+		// which also shifts the color subcarrier phase by a dot.
+		p.cycle = 341
+		p.phase = (p.phase + 12 - 8) % 12
+	}
+	if p.cycle > 340 {
+		p.cycle = 0
+		p.line++
+		if p.line > p.preRenderLine() {
+			p.line = 0
+			p.frame++
+			// A frame shifts the phase by 4 in every line, which causes the dot crawl.
+			p.phase = (p.phase + p.timing.lines * 4) % 12
+		}
+	}
+}
+
+func (p *Ppu) renderPixel(){
+	x := p.cycle - 1
+	bg := p.backgroundPixel()
+	sprite, spriteColor := p.spritePixel()
+
+	// The left 8 pixels are transparent when clipping is enabled,
+	// so the sprite 0 hit never happens there either.
+	if x < 8 && p.isBackgroundClipped() {
+		bg = 0
+	}
+	if x < 8 && p.isSpriteClipped() {
+		spriteColor = 0
+	}
+
+	isBgOpaque := bg % 4 != 0
+	isSpriteOpaque := spriteColor % 4 != 0
+
+	var paletteIdx word
+	if !p.isRenderingEnable() && p.v & 0x3FFF >= 0x3F00 {
+		// While rendering is disabled, the backdrop is replaced
+		// with the palette which the vram address points.
+		paletteIdx = p.v & 0x1F
+	} else if !isBgOpaque && !isSpriteOpaque {
+		// 0x3F04, 0x3F08, 0x3F0C are not used as the backdrop.
+		paletteIdx = 0
+	} else if !isBgOpaque {
+		paletteIdx = word(spriteColor | 0x10)
+	} else if !isSpriteOpaque {
+		paletteIdx = word(bg)
+	} else {
+		if p.hasHitSprite(x, bg, sprite, spriteColor) {
 			p.hitSprite()
 		}
 
-		if p.renderer.line <= 240 && p.renderer.line % 8 == 0 && p.PpuScrollY <= 240{
-			p.buildBackground(p.renderer.line - 1, p.renderer.tiles)
+		if sprite.isUseBg {
+			paletteIdx = word(bg)
+		} else {
+			paletteIdx = word(spriteColor | 0x10)
 		}
+	}
 
-		if p.renderer.line == 241{
-			p.enterVblank()
+	if x == 0 {
+		// A dot lasts 8 phases, so a line (341 dots) shifts the phase by 4.
+		p.renderer.linePhases[p.line] = (p.phase + p.line * 4 + 8) % 12
+	}
+	// The palette is read at every dot, so it can be changed in the middle of the frame.
+	c := p.palette.load(0x3F00 + paletteIdx)
+	p.renderer.setPixel(x, p.line, c, p.emphasisMask())
+}
+
+// emphasisMask returns PpuMask whose emphasis bits are in the order of red, green and blue.
+func (p *Ppu) emphasisMask() byte{
+	mask := p.PpuMask
+	if p.timing.isEmphasisSwapped {
+		// PAL ppu has green in bit 5 and red in bit 6.
+		mask = mask & 0x9F | (mask & 0x20) << 1 | (mask & 0x40) >> 1
+	}
+	return mask
+}
+
+func (p *Ppu) backgroundPixel() byte{
+	if !p.isBackgroundEnable() {
+		return 0
+	}
+
+	data := uint32(p.tileData >> 32) >> ((7 - p.x) * 4)
+	return byte(data & 0x0F)
+}
+
+func (p *Ppu) spritePixel() (*Sprite, byte){
+	if !p.isSpriteEnable() {
+		return nil, 0
+	}
+
+	x := p.cycle - 1
+	for i := 0; i < p.spriteCount; i++ {
+		s := p.sprites[i]
+		offset := x - int(s.x)
+		if offset < 0 || offset > 7 {
+			continue
 		}
 
-		if p.renderer.line == 262 {
-			p.leaveVblank()
-			p.noHitSprite()
-			p.bus.cpu.intrrupt = nil
-			return true
+		c := s.colors[offset]
+		if c == 0 {
+			continue
 		}
+
+		return s, s.paletteId * 4 + c
 	}
 
-	return false
+	return nil, 0
 }
 
 func (p *Ppu) fetchBgChrTable() word{
@@ -234,172 +568,212 @@ func (p *Ppu) fetchSpriteChrTable() word{
 	}
 }
 
-func (p *Ppu) fetchNameTableId() int{
-	return int(p.PpuCtrl & 0x03)
+func (p *Ppu) fetchSpriteHeight() int{
+	if p.PpuCtrl & 0x20 != 0{
+		return 16
+	}else{
+		return 8
+	}
 }
 
-type Tile struct {
-	paletteId int
-	bytes     [8][8]byte
-	scrollX byte
-	scrollY byte
+// fetchBackground emulates the background fetches done in every 8 dots.
+func (p *Ppu) fetchBackground(){
+	p.tileData <<= 4
+	switch p.cycle % 8 {
+	case 1:
+		p.fetchNameTableByte()
+	case 3:
+		p.fetchAttributeByte()
+	case 5:
+		p.fetchLowTileByte()
+	case 7:
+		p.fetchHighTileByte()
+	case 0:
+		p.storeTileData()
+	}
 }
 
-func (p *Ppu) adjustScrollY() int{
-	adjusted := int(p.PpuScrollY) + (int(p.fetchNameTableId() / 2) * 240)
+func (p *Ppu) fetchNameTableByte(){
+	addr := 0x2000 | (p.v & 0x0FFF)
+	p.nameTableByte = p.fetch(addr)
+}
 
-	if p.PpuScrollY >= 240 {
-		// Horizontal offsets range from 0 to 255. "Normal" vertical offsets range from 0 to 239,
-		// while values of 240 to 255 are treated as -16 through -1 in a way,
-		// but tile data is incorrectly fetched from the attribute table.
-		// By changing the values here across several frames and writing tiles to newly revealed areas of the nametables,
-		// one can achieve the effect of a camera panning over a large background.
-		adjusted -= 256
-	}
+func (p *Ppu) fetchAttributeByte(){
+	addr := 0x23C0 | (p.v & 0x0C00) | ((p.v >> 4) & 0x38) | ((p.v >> 2) & 0x07)
+	shift := ((p.v >> 4) & 0x04) | (p.v & 0x02)
+	p.attributeByte = ((p.fetch(addr) >> shift) & 0x03) << 2
+}
 
-	return adjusted
+func (p *Ppu) fetchLowTileByte(){
+	fineY := (p.v >> 12) & 0x07
+	addr := p.fetchBgChrTable() + word(p.nameTableByte) * 16 + fineY
+	p.lowTileByte = p.fetch(addr)
 }
 
-func (p *Ppu) adjustScrollX() int{
-	return int(p.PpuScrollX) + (int(p.fetchNameTableId() % 2) * 256)
+func (p *Ppu) fetchHighTileByte(){
+	fineY := (p.v >> 12) & 0x07
+	addr := p.fetchBgChrTable() + word(p.nameTableByte) * 16 + fineY + 8
+	p.highTileByte = p.fetch(addr)
 }
 
-func (p *Ppu) evaluateNameTableOffset(x, y int) int{
-	tableIdOffset := 0
-	if int(y / 30) % 2 == 1{
-		tableIdOffset = 2
+func (p *Ppu) storeTileData(){
+	var data uint32
+	for i := 0; i < 8; i++ {
+		lo := (p.lowTileByte & 0x80) >> 7
+		hi := (p.highTileByte & 0x80) >> 6
+		p.lowTileByte <<= 1
+		p.highTileByte <<= 1
+		data <<= 4
+		data |= uint32(p.attributeByte | hi | lo)
 	}
+	p.tileData |= uint64(data)
+}
 
-	nameTableId := int(x / 32) % 2 + tableIdOffset
-	return nameTableId * 0x400
+// incrementX increments coarse X, switching the horizontal nametable at the edge.
+func (p *Ppu) incrementX(){
+	if p.v & 0x001F == 31 {
+		p.v &= 0xFFE0
+		p.v ^= 0x0400
+	} else {
+		p.v++
+	}
 }
 
-func (p *Ppu) buildBackground(line int, renderTiles []*Tile){
-	y := int(line / 8)
-	tileY := y + int(p.adjustScrollY() / 8)
-	rotateY := tileY % 30
+// incrementY increments fine Y, and coarse Y when it overflows.
+func (p *Ppu) incrementY(){
+	if p.v & 0x7000 != 0x7000 {
+		p.v += 0x1000
+		return
+	}
 
-	for x:=0; x<32; x++{
-		tileX := x + int(p.adjustScrollX() / 8)
-		rotatedX := tileX % 32
-		nameTableOffset := p.evaluateNameTableOffset(tileX, tileY)
-		sprite, palleteId := p.buildTile(rotatedX, rotateY, nameTableOffset)
-		renderTiles[y * 32 + x] = &Tile{
-			bytes:     sprite,
-			paletteId: palleteId,
-			scrollX: p.PpuScrollX,
-			scrollY: p.PpuScrollY,
-		}
+	p.v &= 0x8FFF
+	y := (p.v & 0x03E0) >> 5
+	if y == 29 {
+		// switch vertical nametable
+		y = 0
+		p.v ^= 0x0800
+	} else if y == 31 {
+		// coarse Y of 30 - 31 points the attribute table, which wraps without switching.
+		y = 0
+	} else {
+		y++
 	}
+	p.v = (p.v & 0xFC1F) | (y << 5)
 }
 
-func (p *Ppu) buildTile(x, y, offset int)([8][8]byte, int){
-	spriteId := p.getSpriteId(x, y, offset)
-	blockId := p.getBlockId(x, y)
-	attr := p.getAttribute(x, y, offset)
-	paletteId := (attr >> (word(blockId) * 2)) & 0x03
-	return p.buildSprite(spriteId, p.fetchBgChrTable()), paletteId
+func (p *Ppu) copyX(){
+	// v: ....F.. ...EDCBA = t: ....F.. ...EDCBA
+	p.v = (p.v & 0xFBE0) | (p.t & 0x041F)
 }
 
-func (p *Ppu) getBlockId(x, y int) int{
-	return int((x % 4) / 2) + (int((y % 4) / 2)) * 2
+func (p *Ppu) copyY(){
+	// v: IHGF.ED CBA..... = t: IHGF.ED CBA.....
+	p.v = (p.v & 0x841F) | (p.t & 0x7BE0)
 }
 
-func (p *Ppu) getAttribute(x, y, offset int) int{
-	addr := word(int(x / 4) + (int(y / 4) * 8) + 0x23C0 + offset)
-	return int(p.vram.load(addr))
+// Sprite is a sprite in range of the current line.
+type Sprite struct {
+	index     int     // index in OAM (sprite 0 is used for the hit test)
+	x         byte
+	tileId    byte
+	attr      byte
+	row       int     // row in the sprite which is drawn on the line
+	colors    [8]byte // colors of the line, already flipped
+	isUseBg   bool    // priority (behind background)
+	paletteId byte
 }
 
-func (p *Ppu) getSpriteId(x, y, offset int) int{
-	addr := word(y * 32 + x + 0x2000 +  offset)
-	return int(p.vram.load(addr))
-}
+// evaluateSprites picks up to 8 sprites which are drawn on the next line.
+// Their patterns are fetched later in fetchSprite.
+func (p *Ppu) evaluateSprites(){
+	height := p.fetchSpriteHeight()
+	count := 0
+
+	for i := 0; i < 64; i++ {
+		// NOTE : Sprite data is delayed by one scanline;
+		// the sprite with Y is displayed from the line Y+1.
+		// Hide a sprite by writing any values in $EF-$FF here.
+		y := p.spriteRam.load(word(i * 4))
+		row := p.line - int(y)
+		if row < 0 || row >= height {
+			continue
+		}
 
-func (p *Ppu) buildSprite(spriteId int, offset word) [8][8]byte{
-	var sprite [8][8]byte
-	var i, j word
-	for i = 0; i<16; i++{
-		for  j = 0; j<8; j++{
-			addr := word(spriteId) * 16 + i + offset
-			b := p.vram.load(addr)
-			if b & (0x80 >> j) != 0x00{
-				sprite[i%8][j] += 0x01 << uint(i/8) // 0, 1, 3
+		if count < 8 {
+			attr := p.spriteRam.load(word(i * 4 + 2))
+			p.sprites[count] = &Sprite{
+				index:     i,
+				x:         p.spriteRam.load(word(i * 4 + 3)),
+				tileId:    p.spriteRam.load(word(i * 4 + 1)),
+				attr:      attr,
+				row:       row,
+				isUseBg:   attr & 0x20 != 0,
+				paletteId: attr & 0x03,
 			}
 		}
+		count++
 	}
-	return sprite
-}
 
-func (p *Ppu) getBackgroundPalette() [16]color.RGBA{
-	var currentPalette [16]color.RGBA
-	for i, b := range p.vram.slice(0x3F00, 0x3F10){
-		if i % 4 == 0 {
-			// 0x3F04, 0x3F08, 0x3C0C are ignored by background.
-			// Instead of here, use these values in the sprite palette.
-			currentPalette[i] = systemPalette[p.vram.load(0x3F00)]
-		}else{
-			currentPalette[i] = systemPalette[b]
-		}
+	if count > 8 {
+		count = 8
+		p.setSpriteOverflow()
 	}
-	return currentPalette
+	p.spriteCount = count
 }
 
-func (p *Ppu) getSpritePalette() [16]color.RGBA{
-	var currentPalette [16]color.RGBA
-	for i, b := range p.vram.slice(0x3F10, 0x3F20){
-		if i % 4 == 0 {
-			// 0x3F10, 0x3F14, 0x3F18, 0x3F1C are mirror of 0x3F00, 0x3F04, 0x3F08, 0x3CFC
-			currentPalette[i] = systemPalette[p.vram.load(word(0x3F00+i))]
-		}else{
-			currentPalette[i] = systemPalette[b]
-		}
+// fetchSprite emulates the sprite fetches done in dots 257 - 320, 8 dots for each of 8 sprites.
+// Slots without a sprite fetch the tile $FF, as the hardware does.
+func (p *Ppu) fetchSprite(){
+	i := (p.cycle - 257) / 8
+	s := &Sprite{tileId: 0xFF}
+	if i < p.spriteCount {
+		s = p.sprites[i]
 	}
-	return currentPalette
-}
 
-type Sprite struct {
-	y byte
-	x byte
-	bytes [8][8]byte
-	isVerticalReverse bool
-	isHorizontalReverse bool
-	isUseBg bool
-	paletteId byte
+	switch (p.cycle - 257) % 8 {
+	case 0, 2:
+		// garbage nametable fetches
+		p.fetch(0x2000 | (p.v & 0x0FFF))
+	case 4:
+		p.spriteLowByte = p.fetch(p.spritePatternAddr(s))
+	case 6:
+		hi := p.fetch(p.spritePatternAddr(s) + 8)
+		s.colors = buildSpriteColors(p.spriteLowByte, hi, s.attr)
+	}
 }
 
+func (p *Ppu) spritePatternAddr(s *Sprite) word{
+	row := s.row
+	tileId := s.tileId
+	height := p.fetchSpriteHeight()
+	if s.attr & 0x80 != 0 {
+		// vertical reverse
+		row = height - 1 - row
+	}
 
-func (p *Ppu) buildSprites(){
-	offset := p.fetchSpriteChrTable()
-
-	for i := 0; i < 0x0100; i+=4 {
-		// INFO: Offset sprite Y position,
-		// because First and last 8line is not rendered.
-		y := p.spriteRam.load(word(i)) // - 8
-
-		if y < 0 {
-			return
+	table := p.fetchSpriteChrTable()
+	if height == 16 {
+		// 8x16 sprites select the pattern table by bit 0 of the tile id.
+		table = word(tileId & 0x01) * 0x1000
+		tileId &= 0xFE
+		if row > 7 {
+			tileId++
+			row -= 8
 		}
+	}
 
-		spriteId := p.spriteRam.load(word(i) + 1)
-		attr := p.spriteRam.load(word(i) + 2)
-		x := p.spriteRam.load(word(i) + 3)
-		bytes := p.buildSprite(int(spriteId), offset)
-
-		sprite := &Sprite{
-			// NOTE : Sprite data is delayed by one scanline;
-			// you must subtract 1 from the sprite's Y coordinate before writing it here.
-			// Hide a sprite by writing any values in $EF-$FF here.
-			// Sprites are never displayed on the first line of the picture,
-			// and it is impossible to place a sprite partially off the top of the screen.
-			y:y-1,
-			x:x,
-			bytes:bytes,
-			isVerticalReverse:attr & 0x80 != 0,
-			isHorizontalReverse:attr & 0x40 != 0,
-			isUseBg:attr & 0x20 != 0,
-			paletteId:attr & 0x03,
-		}
+	return table + word(tileId) * 16 + word(row)
+}
 
-		p.spriteBuffer[i/4] = sprite
+func buildSpriteColors(lo byte, hi byte, attr byte) [8]byte{
+	var colors [8]byte
+	for j := uint(0); j < 8; j++ {
+		shift := 7 - j
+		if attr & 0x40 != 0 {
+			// horizontal reverse
+			shift = j
+		}
+		colors[j] = (lo >> shift) & 0x01 | ((hi >> shift) & 0x01) << 1
 	}
-}
\ No newline at end of file
+	return colors
+}
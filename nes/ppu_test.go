@@ -0,0 +1,179 @@
+package nes
+
+import "testing"
+
+// testCart is NROM (or the mapper) with 32KB PRG-ROM and blank CHR-ROM for the unit tests.
+type testCart struct {
+	prgRom   []byte
+	region   Region
+	mapperNo int
+}
+
+func (c *testCart) PrgRom() []byte           { return c.prgRom }
+func (c *testCart) ChrRom() []byte           { return make([]byte, 0x2000) }
+func (c *testCart) ChrRamSize() int          { return 0 }
+func (c *testCart) IsHorizontalMirror() bool { return false }
+func (c *testCart) Region() Region           { return c.region }
+func (c *testCart) MapperNo() int            { return c.mapperNo }
+func (c *testCart) ExpansionDevice() byte    { return 0 }
+func (c *testCart) Checksum() [16]byte       { return [16]byte{} }
+
+// newTestNes returns the console which runs the program from $8000.
+// The vectors are nmi $8100, reset $8000 and irq $8200.
+func newTestNes(region Region, program ...byte) *Nes {
+	prg := make([]byte, 0x8000)
+	copy(prg, program)
+	copy(prg[0x7FFA:], []byte{0x00, 0x81, 0x00, 0x80, 0x00, 0x82})
+	n := NewNes(&testCart{prgRom: prg, region: region})
+	n.Init()
+	return n
+}
+
+// isNmiPending reports whether nmi is raised and not handled yet.
+func isNmiPending(n *Nes) bool {
+	return n.cpu.isNmiPending
+}
+
+// stepTo runs the ppu dot by dot until the dot of the line is the next one.
+func stepTo(p *Ppu, line int, dot int) {
+	for p.line != line || p.cycle != dot {
+		p.step()
+	}
+}
+
+// readStatus reads $2002 through the bus between the dots where the ppu is.
+func readStatus(n *Nes) byte {
+	n.cpu.accessCycle = n.ppu.cpuCycle
+	return n.bus.Load(0x2002)
+}
+
+func TestPpuRunByMasterClock(t *testing.T) {
+	tests := []struct {
+		region Region
+		cycles uint64
+		dots   int
+	}{
+		{NTSC, 10, 30},
+		{PAL, 5, 16},
+		{Dendy, 10, 30},
+	}
+	for _, tt := range tests {
+		p := newTestNes(tt.region).ppu
+		p.run(tt.cycles)
+		if p.line != 0 || p.cycle != tt.dots {
+			t.Errorf("%v: %d cycles run to line %d dot %d, want line 0 dot %d", tt.region, tt.cycles, p.line, p.cycle, tt.dots)
+		}
+	}
+}
+
+func TestVblankFlagDots(t *testing.T) {
+	n := newTestNes(NTSC)
+	p := n.ppu
+
+	stepTo(p, 241, 1)
+	if p.PpuStatus & 0x80 != 0 {
+		t.Fatal("vblank is set before line 241 dot 1")
+	}
+	p.step()
+	if p.PpuStatus & 0x80 == 0 {
+		t.Fatal("vblank is not set at line 241 dot 1")
+	}
+
+	stepTo(p, 261, 1)
+	if p.PpuStatus & 0x80 == 0 {
+		t.Fatal("vblank is cleared before line 261 dot 1")
+	}
+	p.step()
+	if p.PpuStatus & 0x80 != 0 {
+		t.Fatal("vblank is not cleared at line 261 dot 1")
+	}
+}
+
+// TestVblankReadRace reads $2002 around the dot where vblank starts.
+// A read one dot before it reads vblank as clear and suppresses both the flag and nmi,
+// and a read at the dot or one dot later reads it as set but suppresses nmi.
+func TestVblankReadRace(t *testing.T) {
+	tests := []struct {
+		dot      int // the next dot of line 241 when $2002 is read
+		isVblank bool
+		isNmi    bool
+	}{
+		{0, false, true},
+		{1, false, false},
+		{2, true, false},
+		{3, true, false},
+		{4, true, true},
+	}
+	for _, tt := range tests {
+		n := newTestNes(NTSC)
+		p := n.ppu
+		p.PpuCtrl = 0x80
+
+		stepTo(p, 241, tt.dot)
+		status := readStatus(n)
+		stepTo(p, 241, 10)
+
+		if isVblank := status & 0x80 != 0; isVblank != tt.isVblank {
+			t.Errorf("read before dot %d: vblank %v, want %v", tt.dot, isVblank, tt.isVblank)
+		}
+		if isNmiPending(n) != tt.isNmi {
+			t.Errorf("read before dot %d: nmi %v, want %v", tt.dot, isNmiPending(n), tt.isNmi)
+		}
+		if tt.dot == 1 && p.PpuStatus & 0x80 != 0 {
+			t.Errorf("read before dot 1: vblank is set in the frame")
+		}
+	}
+}
+
+func TestNmiDisabledJustAfterVblank(t *testing.T) {
+	n := newTestNes(NTSC)
+	p := n.ppu
+	p.PpuCtrl = 0x80
+
+	stepTo(p, 241, 2)
+	p.writePpuCtrl(0x00)
+	if isNmiPending(n) {
+		t.Error("nmi is raised after it is disabled just after vblank starts")
+	}
+
+	p.writePpuCtrl(0x80)
+	if !isNmiPending(n) {
+		t.Error("nmi is not raised when it is enabled in vblank")
+	}
+}
+
+// frameDots runs a frame from line 0 dot 0, and returns the dots of it.
+func frameDots(p *Ppu) int {
+	dots := 0
+	for {
+		p.step()
+		dots++
+		if p.line == 0 && p.cycle == 0 {
+			return dots
+		}
+	}
+}
+
+func TestOddFrameDotSkip(t *testing.T) {
+	p := newTestNes(NTSC).ppu
+	if even, odd := frameDots(p), frameDots(p); even != 89342 || odd != 89342 {
+		t.Errorf("rendering off: frames of %d and %d dots, want 89342 and 89342", even, odd)
+	}
+
+	p.PpuMask = 0x08
+	if even, odd := frameDots(p), frameDots(p); even != 89342 || odd != 89341 {
+		t.Errorf("rendering on: frames of %d and %d dots, want 89342 and 89341", even, odd)
+	}
+
+	// 2 frames are 59561 cpu cycles while rendering.
+	p.run(p.cpuCycle + 59561)
+	if p.line != 0 || p.cycle != 0 {
+		t.Errorf("2 frames run to line %d dot %d, want line 0 dot 0", p.line, p.cycle)
+	}
+
+	p = newTestNes(PAL).ppu
+	p.PpuMask = 0x08
+	if even, odd := frameDots(p), frameDots(p); even != 106392 || odd != 106392 {
+		t.Errorf("PAL: frames of %d and %d dots, want 106392 and 106392", even, odd)
+	}
+}
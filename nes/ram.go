@@ -29,18 +29,41 @@ func (m *Ram) slice(begin int, end int) []byte{
 	return m.data[begin:end]
 }
 
+// ROM for cartridge, writes are ignored.
+type Rom struct{
+	data []byte
+}
+
+func NewRom(data []byte) Mem {
+	return &Rom{
+		data:data,
+	}
+}
+
+func (m *Rom) load(addr word) byte{
+	return m.data[addr]
+}
+
+func (m *Rom) store(addr word, b byte){
+	// read only
+}
+
+func (m *Rom) slice(begin int, end int) []byte{
+	return m.data[begin:end]
+}
+
 // Ram for ppu
 type VRam struct{
-	data []byte
-	isHorizontalMirror bool
+	data []byte // nametables (0x2000 - 0x2FFF)
+	mapper Mapper // pattern tables (0x0000 - 0x1FFF) and mirroring on the cartridge
+	palette Mem // palette (0x3F00 - 0x3FFF)
 }
 
-func NewVRamInit(size int, init []byte, isHorizontalMirror bool) Mem {
-	ram := make([]byte, size)
-	copy(ram, init)
+func NewVRam(mapper Mapper, palette Mem) Mem {
 	return &VRam{
-		data:ram,
-		isHorizontalMirror:isHorizontalMirror,
+		data:make([]byte, 0x1000),
+		mapper:mapper,
+		palette:palette,
 	}
 }
 
@@ -48,37 +71,53 @@ func isNameTable1(addr word) bool{
 	return addr >= 0x2400 && addr < 0x2800
 }
 
+func isNameTable2(addr word) bool{
+	return addr >= 0x2800 && addr < 0x2C00
+}
+
 func isNameTable3(addr word) bool{
 	return addr >= 0x2C00 && addr < 0x3000
 }
 
+// mirrorNameTable maps $2400-$2FFF onto the two physical nametables.
+// horizontal: $2000 = $2400, $2800 = $2C00
+// vertical  : $2000 = $2800, $2400 = $2C00
+func (m *VRam) mirrorNameTable(addr word) word{
+	if nm, ok := m.mapper.(nameTableMapper); ok {
+		return nm.mirrorNameTable(addr)
+	}
+	if m.mapper.isHorizontalMirror(){
+		if isNameTable1(addr) || isNameTable3(addr){
+			return addr - 0x0400
+		}
+	}else{
+		if isNameTable2(addr) || isNameTable3(addr){
+			return addr - 0x0800
+		}
+	}
+	return addr
+}
+
 func (m *VRam) load(addr word) byte{
 	// always mirroring
 	if addr >= 0x4000{
 		addr %= 0x4000
 	}
 
-	if addr >= 0x3000 && addr < 0x3F00 {
-		return m.data[addr - 0x1000]
+	if addr < 0x2000 {
+		return m.mapper.loadChr(addr)
 	}
 
-	if addr == 0x3F10 || addr == 0x3F14 || addr == 0x3F18 || addr == 0x3F1C{
-		return m.data[addr - 0x10]
+	if addr >= 0x3F00 {
+		return m.palette.load(addr)
 	}
 
-	if addr >= 0x3F20 && addr <= 0x3FFF {
-		return m.data[0x3F00 + (addr % 0x20)]
-	}
-
-	if isNameTable1(addr) || isNameTable3(addr){
-		if m.isHorizontalMirror{
-			return m.data[addr-0x0400]
-		}else{
-			return m.data[addr /* -0x0800 */ ]
-		}
+	if addr >= 0x3000 {
+		// 0x3000 - 0x3EFF is mirror of 0x2000 - 0x2EFF
+		addr -= 0x1000
 	}
 
-	return m.data[addr]
+	return m.data[m.mirrorNameTable(addr) - 0x2000]
 }
 
 func (m *VRam) store(addr word, b byte){
@@ -87,37 +126,56 @@ func (m *VRam) store(addr word, b byte){
 		addr %= 0x4000
 	}
 
-	if addr >= 0x3000 && addr < 0x3F00 {
-		// 0x3000 - 0x3EFF is mirror of 0x2000 - 0x2EFF
-		m.data[addr - 0x1000] = b
+	if addr < 0x2000 {
+		m.mapper.storeChr(addr, b)
 		return
 	}
 
-	if addr == 0x3F10 || addr == 0x3F14 || addr == 0x3F18 || addr == 0x3F1C{
-		// $3F10/$3F14/$3F18/$3F1C are mirror of $3F00/$3F04/$3F08/$3F0C.
-		m.data[addr - 0x10] = b
+	if addr >= 0x3F00 {
+		m.palette.store(addr, b)
 		return
 	}
 
-	if addr >= 0x3F20 && addr <= 0x3FFF {
-		// 0x3F20 - 0x3FFF is mirror of 0x3F00 - 0x3F1F
-		m.data[0x3F00 + (addr % 0x20)] = b
-		return
+	if addr >= 0x3000 {
+		// 0x3000 - 0x3EFF is mirror of 0x2000 - 0x2EFF
+		addr -= 0x1000
 	}
 
-	if isNameTable1(addr) || isNameTable3(addr){
-		if m.isHorizontalMirror{
-			m.data[addr - 0x0400] = b
-		}else{
-			m.data[addr /* - 0x0800 */ ] = b
-		}
-		return
+	m.data[m.mirrorNameTable(addr) - 0x2000] = b
+}
+
+func (m *VRam) slice(begin int, end int) []byte{
+	return m.data[begin - 0x2000:end - 0x2000]
+}
+
+// Ram for palette (32 bytes of 6 bits)
+type PaletteRam struct{
+	data [0x20]byte
+}
+
+func NewPaletteRam() Mem {
+	return &PaletteRam{}
+}
+
+// mirrorPalette maps 0x3F00 - 0x3FFF onto 32 bytes.
+// 0x3F20 - 0x3FFF is mirror of 0x3F00 - 0x3F1F,
+// and $3F10/$3F14/$3F18/$3F1C are mirror of $3F00/$3F04/$3F08/$3F0C.
+func mirrorPalette(addr word) word{
+	addr &= 0x1F
+	if addr & 0x13 == 0x10 {
+		addr &= 0x0F
 	}
+	return addr
+}
 
-	m.data[addr] = b
+func (m *PaletteRam) load(addr word) byte{
+	return m.data[mirrorPalette(addr)]
 }
 
-func (m *VRam) slice(begin int, end int) []byte{
-	return m.data[begin:end]
+func (m *PaletteRam) store(addr word, b byte){
+	m.data[mirrorPalette(addr)] = b & 0x3F
 }
 
+func (m *PaletteRam) slice(begin int, end int) []byte{
+	return m.data[begin - 0x3F00:end - 0x3F00]
+}
@@ -0,0 +1,95 @@
+package nes
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// RamPattern is the content of RAM at power-on.
+// Real RAM powers up with a pattern which depends on the chips,
+// so games which read RAM before writing it may work only by chance on zeroed RAM.
+type RamPattern int
+
+const(
+	RamZeros RamPattern = iota
+	RamOnes        // $FF
+	RamAlternating // $00 $00 $00 $00 $FF $FF $FF $FF, which is common on the consoles
+	RamRandom      // random bytes from the seed
+)
+
+func (p RamPattern) String() string{
+	switch p {
+	case RamZeros: return "zeros"
+	case RamOnes: return "ff"
+	case RamAlternating: return "alternating"
+	case RamRandom: return "random"
+	}
+	panic("Unable to reach here")
+}
+
+// ParseRamPattern parses the pattern name given by user.
+func ParseRamPattern(s string) (RamPattern, error){
+	switch strings.ToLower(s) {
+	case "zeros":
+		return RamZeros, nil
+	case "ff":
+		return RamOnes, nil
+	case "alternating":
+		return RamAlternating, nil
+	case "random":
+		return RamRandom, nil
+	}
+	return RamZeros, fmt.Errorf("unknown ram pattern `%s` (zeros, ff, alternating or random)", s)
+}
+
+// PowerOnRam is how WRAM, VRAM, OAM and the RAM on the cartridge are filled at power-on.
+type PowerOnRam struct {
+	Pattern RamPattern
+	Seed    int64 // seed of RamRandom, which makes the same content every power-on
+}
+
+// fill fills the memories in order. RamRandom goes on through them with a single seed.
+func (r PowerOnRam) fill(mems ...[]byte){
+	random := rand.New(rand.NewSource(r.Seed))
+	for _, m := range mems {
+		for i := range m {
+			switch r.Pattern {
+			case RamZeros:
+				m[i] = 0x00
+			case RamOnes:
+				m[i] = 0xFF
+			case RamAlternating:
+				if i & 0x04 == 0 {
+					m[i] = 0x00
+				} else {
+					m[i] = 0xFF
+				}
+			case RamRandom:
+				m[i] = byte(random.Intn(0x100))
+			}
+		}
+	}
+}
+
+// SetPowerOnRam sets the content of RAM at power-on, which is used from the next PowerCycle.
+// Before the first frame, it fills RAM of the console now.
+func (n *Nes) SetPowerOnRam(r PowerOnRam){
+	n.powerOnRam = r
+	if n.frameCount == 0 {
+		n.fillRam()
+	}
+}
+
+// fillRam fills RAM as it is at power-on.
+func (n *Nes) fillRam(){
+	mems := [][]byte{
+		n.bus.wram.slice(0, 0x800),
+		n.ppu.vram.slice(0x2000, 0x3000),
+		n.ppu.spriteRam.slice(0, 0x100),
+	}
+	if m, ok := n.bus.mapper.(cartRamMapper); ok {
+		mems = append(mems, m.cartRam()...)
+	}
+	n.powerOnRam.fill(mems...)
+}
@@ -0,0 +1,158 @@
+package nes
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type Region int
+
+const(
+	NTSC Region = iota
+	PAL
+	Dendy
+)
+
+func (r Region) String() string{
+	switch r {
+	case NTSC: return "NTSC"
+	case PAL: return "PAL"
+	case Dendy: return "Dendy"
+	}
+	panic("Unable to reach here")
+}
+
+// ParseRegion parses the region name given by user.
+func ParseRegion(s string) (Region, error){
+	switch strings.ToLower(s) {
+	case "ntsc":
+		return NTSC, nil
+	case "pal":
+		return PAL, nil
+	case "dendy":
+		return Dendy, nil
+	}
+	return NTSC, fmt.Errorf("unknown region `%s` (ntsc, pal or dendy)", s)
+}
+
+type regionTiming struct {
+	lines             int     // scanlines per frame including the pre-render line
+	vblankLine        int     // the line where vblank starts
+	cpuClockDivider   int     // master clocks per cpu cycle
+	ppuClockDivider   int     // master clocks per ppu dot
+	frameRate         float64 // Hz
+	pixelAspect       float64 // width / height of a pixel on TVs
+	isOddFrameSkip    bool    // the last dot of the pre-render line is skipped in odd frames
+	isEmphasisSwapped bool    // red and green emphasis bits are swapped
+}
+
+var regionTimings = map[Region]regionTiming{
+	// 21.477272 MHz master clock, 3 dots per cpu cycle
+	NTSC: {lines: 262, vblankLine: 241, cpuClockDivider: 12, ppuClockDivider: 4, frameRate: 60.0988, pixelAspect: 8.0 / 7, isOddFrameSkip: true},
+	// 26.601712 MHz master clock, 3.2 dots per cpu cycle
+	PAL: {lines: 312, vblankLine: 241, cpuClockDivider: 16, ppuClockDivider: 5, frameRate: 50.007, pixelAspect: 2950000.0 / 2128137, isEmphasisSwapped: true},
+	// 26.601712 MHz master clock, 3 dots per cpu cycle, and vblank starts after 51 post-render lines
+	Dendy: {lines: 312, vblankLine: 291, cpuClockDivider: 15, ppuClockDivider: 5, frameRate: 50.007, pixelAspect: 2950000.0 / 2128137, isEmphasisSwapped: true},
+}
+
+func (r Region) timing() regionTiming{
+	return regionTimings[r]
+}
+
+// FrameRate returns the refresh rate of the console in Hz.
+func (r Region) FrameRate() float64{
+	return r.timing().frameRate
+}
+
+// romRegions is the rom database of the regions, keyed by md5 of PRG-ROM and CHR-ROM (Ines.Checksum).
+// It is filled by LoadRegionDatabase.
+var romRegions = map[[16]byte]Region{}
+
+// LoadRegionDatabase adds the regions of the roms in the file to the database,
+// which is looked up by NewCassette. Each line is "<md5 of PRG-ROM and CHR-ROM> <region>",
+// and the rest of the line after "#" is a comment, e.g.
+//
+//	0123456789abcdef0123456789abcdef pal # Game (Europe)
+func LoadRegionDatabase(path string) error{
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", path, err)
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: want \"<md5> <region>\"", path, i + 1)
+		}
+
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != 16 {
+			return fmt.Errorf("%s:%d: invalid md5 `%s`", path, i + 1, fields[0])
+		}
+		var sum [16]byte
+		copy(sum[:], b)
+		region, err := ParseRegion(fields[1])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, i + 1, err)
+		}
+		romRegions[sum] = region
+	}
+	return nil
+}
+
+// regionFromDatabase looks up the region of the rom in the database.
+func regionFromDatabase(checksum [16]byte) (Region, bool){
+	region, ok := romRegions[checksum]
+	return region, ok
+}
+
+// palRegionTags are the region names of GoodNES and No-Intro which are only sold in PAL.
+// Short tags like "(A)" or "(F)" are not guessed, because they are also used for other meanings.
+var palRegionTags = []string{
+	"e", "europe", "pal", "australia", "germany", "france", "spain", "italy",
+	"sweden", "netherlands", "scandinavia", "united kingdom",
+}
+
+var fileNameTagPattern = regexp.MustCompile(`\(([^()]*)\)`)
+
+// regionFromFileName guesses the region from the region tags of the common rom naming conventions,
+// e.g. "Game (Europe).nes", "Game (E) [!].nes" and "Game (Europe, Australia).nes".
+// A tag which has any other region, e.g. "(USA, Europe)", runs on NTSC.
+func regionFromFileName(path string) (Region, bool){
+	name := strings.ToLower(filepath.Base(path))
+	for _, m := range fileNameTagPattern.FindAllStringSubmatch(name, -1) {
+		if m[1] == "dendy" {
+			return Dendy, true
+		}
+
+		isPal := true
+		for _, tag := range strings.Split(m[1], ",") {
+			if !containsString(palRegionTags, strings.TrimSpace(tag)) {
+				isPal = false
+			}
+		}
+		if isPal {
+			return PAL, true
+		}
+	}
+	return NTSC, false
+}
+
+func containsString(list []string, s string) bool{
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
@@ -2,7 +2,6 @@ package nes
 
 import (
 	"image"
-	"image/color"
 )
 
 var(
@@ -11,123 +10,46 @@ var(
 )
 
 type Renderer struct {
-	line              int
-	tiles             []*Tile
-	backgroundPalette [16]color.RGBA
-	spritePalette     [16]color.RGBA
+	palettes          Palette // indexed by emphasis bits
 	img               *image.RGBA
-	sprites           [64]*Sprite
-	ppuMask           byte  // ppu 0x2002
+	pixels            []uint16 // raw pixels ("eeellcccc") for ntsc filter
+	linePhases        []int    // color subcarrier phase where each line starts
+	filter            *NtscFilter
 }
 
 func NewRenderer() *Renderer{
 	return &Renderer{
-		line:0,
-		tiles:make([]*Tile, 30*32),
+		palettes:newEmphasisPalettes(systemPalette),
 		img:image.NewRGBA(image.Rectangle{Min: UpLeft, Max: DownRight}),
+		pixels:make([]uint16, 256*240),
+		linePhases:make([]int, 240),
 	}
 }
 
+// Buffer returns the frame, filtered by ntsc filter if it is enabled.
 func (r *Renderer) Buffer() *image.RGBA{
-	return r.img
-}
-
-func (r *Renderer) render(ppuMask byte, isBgEnabled bool, isSpriteEnabled bool){
-	r.ppuMask = ppuMask
-
-	if isBgEnabled{
-		r.renderBackground(r.tiles)
-	}
-
-	if isSpriteEnabled{
-		r.renderSprites(r.sprites)
-	}
-}
-
-func (r *Renderer) renderBackground(background []*Tile){
-	for i:= 0; i < len(background); i++ {
-		x := (i % 32) * 8
-		y := int(i / 32) * 8
-		r.renderTile(background[i], x, y)
+	if r.filter != nil {
+		return r.filter.apply(r.pixels, r.linePhases)
 	}
+	return r.img
 }
 
-func (r *Renderer) renderTile(tile *Tile, tileX, tileY int){
-	offsetX := tile.scrollX % 8
-	offsetY := tile.scrollY % 8
-	for i := 0; i < 8; i++ {
-		for j:= 0; j < 8; j++ {
-			paletteIdx := int(tile.paletteId) * 4  + int(tile.bytes[i][j])
-			rgba := r.backgroundPalette[paletteIdx]
-			x := tileX + j - int(offsetX)
-			y := tileY + i - int(offsetY)
-			x = int(byte(x))
-			y = int(byte(y))
-
-			if x >= 0 && x <= 0xFF && y >= 0 && y < 240 {
-				r.img.SetRGBA(x, y, rgba)
-			}
-		}
+// setPixel draws a pixel with the color of the system palette (0x00-0x3F).
+// ppuMask($2001) applies greyscale and color emphasis.
+func (r *Renderer) setPixel(x, y int, c byte, ppuMask byte){
+	c &= 0x3F
+	if ppuMask & 0x01 != 0 {
+		// greyscale uses only the grey column ($x0).
+		c &= 0x30
 	}
-}
 
-func (r *Renderer) renderSprites(sprites [64]*Sprite){
-	for _, s := range sprites{
-		if s != nil{
-			r.renderSprite(s)
-		}
-	}
+	emphasis := ppuMask >> 5
+	r.pixels[y * 256 + x] = uint16(emphasis) << 6 | uint16(c)
+	r.img.SetRGBA(x, y, r.palettes[emphasis][c])
 }
 
-func (r *Renderer) reverse(b [8][8]byte, isHorizontal bool) [8][8]byte{
-	var buf [8][8]byte
-
-	if isHorizontal {
-		for i := 0; i < 8; i++ {
-			for j := 0; j < 8; j++ {
-				buf[i][j] = b[i][7-j]
-			}
-		}
-		return buf
-	}
-
-	// vertical
-	for i := 0; i < 8; i++ {
-		for j := 0; j < 8; j++ {
-			buf[i][j] = b[7-i][j]
-		}
-	}
-
-	return buf
+// brightness returns the luma (0 - 255) of the pixel drawn at (x, y).
+func (r *Renderer) brightness(x, y int) int{
+	c := r.img.RGBAAt(x, y)
+	return (299 * int(c.R) + 587 * int(c.G) + 114 * int(c.B)) / 1000
 }
-
-func (r *Renderer) renderSprite(sprite *Sprite){
-
-	if sprite.isUseBg{
-		return
-	}
-
-	if sprite.isHorizontalReverse{
-		sprite.bytes = r.reverse(sprite.bytes, true)
-	}else if sprite.isVerticalReverse{
-		sprite.bytes = r.reverse(sprite.bytes, false)
-	}
-
-	for i := 0; i < 8; i++ {
-		for j:= 0; j < 8; j++ {
-
-			if sprite.bytes[i][j] == 0 {
-				continue
-			}
-
-			paletteIdx := int(sprite.paletteId) * 4 + int(sprite.bytes[i][j])
-			rgba := r.spritePalette[paletteIdx]
-			x := int(sprite.x) + j
-			y := int(sprite.y) + i
-			x = int(byte(x))
-			y = int(byte(y))
-
-			r.img.SetRGBA(x, y, rgba)
-		}
-	}
-}
\ No newline at end of file
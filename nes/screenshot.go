@@ -0,0 +1,131 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// overscanLines are the lines at the top and the bottom which most TVs hide.
+const overscanLines = 8
+
+// ScreenshotOptions is how the screenshot is made from the picture. The zero value is the raw picture.
+type ScreenshotOptions struct {
+	IsCropped         bool // remove the overscan lines at the top and the bottom
+	IsAspectCorrected bool // scale the width by the pixel aspect ratio of the region, e.g. 8:7 in NTSC
+	Scale             int  // scale of the height, which is 1 if it is 0
+}
+
+// Screenshot returns a copy of the last frame made by the options.
+// The raw picture is 256x240, or NtscWidth wide with the ntsc filter.
+func (n *Nes) Screenshot(o ScreenshotOptions) *image.RGBA {
+	src := n.Buffer()
+	bounds := src.Bounds()
+	if o.IsCropped {
+		bounds.Min.Y += overscanLines
+		bounds.Max.Y -= overscanLines
+	}
+
+	scale := o.Scale
+	if scale < 1 {
+		scale = 1
+	}
+	w := bounds.Dx() * scale
+	if o.IsAspectCorrected {
+		// the ntsc filter makes more samples of the same 256 pixels
+		w = int(math.Round(256 * n.region.timing().pixelAspect * float64(scale)))
+	}
+	h := bounds.Dy() * scale
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy := bounds.Min.Y + y / scale
+		for x := 0; x < w; x++ {
+			sx := bounds.Min.X + x * bounds.Dx() / w
+			img.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return img
+}
+
+// WriteScreenshot writes the screenshot in PNG, which has the rom name and the frame in the text chunks.
+func (n *Nes) WriteScreenshot(w io.Writer, romName string, o ScreenshotOptions) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, n.Screenshot(o)); err != nil {
+		return err
+	}
+	return writePngWithText(w, buf.Bytes(), []pngText{
+		{keyword: "Software", text: "goones"},
+		{keyword: "ROM", text: romName, isUtf8: true},
+		{keyword: "Frame", text: strconv.FormatUint(n.frameCount, 10)},
+	})
+}
+
+// SaveScreenshot saves the screenshot into dir with the name of the rom and the time,
+// e.g. "mario-20060102-150405.000.png", and returns the path.
+func (n *Nes) SaveScreenshot(dir string, romName string, o ScreenshotOptions) (string, error) {
+	name := romName
+	if name == "" {
+		name = "goones"
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.png", name, time.Now().Format("20060102-150405.000")))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := n.WriteScreenshot(f, romName, o); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// pngHeaderSize is the signature and the IHDR chunk, which must be the first chunk.
+const pngHeaderSize = 8 + 4 + 4 + 13 + 4
+
+// pngText is the text chunk of the keyword.
+// tEXt is Latin-1 only, so the text which can be any name, e.g. the rom name, is written in iTXt (UTF-8).
+type pngText struct {
+	keyword string
+	text    string
+	isUtf8  bool
+}
+
+// chunk returns the type and the data of the chunk.
+// iTXt has no compression, language tag and translated keyword.
+func (t pngText) chunk() []byte {
+	if t.isUtf8 {
+		return append([]byte("iTXt" + t.keyword + "\x00\x00\x00\x00\x00"), t.text...)
+	}
+	return append([]byte("tEXt" + t.keyword + "\x00"), t.text...)
+}
+
+// writePngWithText inserts the text chunks after IHDR, because image/png doesn't write them.
+func writePngWithText(w io.Writer, data []byte, texts []pngText) error {
+	if _, err := w.Write(data[:pngHeaderSize]); err != nil {
+		return err
+	}
+	for _, t := range texts {
+		chunk := t.chunk()
+		var length, crc [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(chunk) - 4))
+		binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(chunk))
+		for _, b := range [][]byte{length[:], chunk, crc[:]} {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := w.Write(data[pngHeaderSize:])
+	return err
+}
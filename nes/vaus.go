@@ -0,0 +1,75 @@
+package nes
+
+const (
+	// the range of the potentiometer which Arkanoid accepts
+	vausMin = 0x62
+	vausMax = 0xF2
+)
+
+// Vaus is the paddle of Arkanoid. The potentiometer is shifted out serially
+// (inverted, MSB first) after the strobe, and the button is read in parallel.
+//
+// NES: port 2, data in bit 4 and button in bit 3 of $4017.
+// Famicom: expansion port, button in bit 1 of $4016 and data in bit 1 of $4017.
+type Vaus struct {
+	position byte
+	isPushed bool
+	reset    byte
+	shifter  byte // latched position which is shifted out
+}
+
+func NewVaus() *Vaus{
+	return &Vaus{
+		position: (vausMin + vausMax) / 2,
+	}
+}
+
+// Move turns the knob so that the paddle goes to x (0 - 255) on the screen.
+func (v *Vaus) Move(x int){
+	if x < 0 {
+		x = 0
+	} else if x > 255 {
+		x = 255
+	}
+	v.position = byte(vausMin + x * (vausMax - vausMin) / 255)
+}
+
+// Push pushes or releases the button.
+func (v *Vaus) Push(isPushed bool){
+	v.isPushed = isPushed
+}
+
+func (v *Vaus) Write(b byte){
+	v.reset = b
+	if v.reset & 1 == 1 {
+		v.shifter = ^v.position
+	}
+}
+
+func (v *Vaus) button() byte{
+	if v.isPushed {
+		return 1
+	}
+	return 0
+}
+
+func (v *Vaus) shift() byte{
+	b := v.shifter >> 7
+	if v.reset & 1 == 0 {
+		v.shifter <<= 1
+	}
+	return b
+}
+
+// Read is used when the Vaus is connected to a port of NES.
+func (v *Vaus) Read() byte{
+	return v.shift() << 4 | v.button() << 3
+}
+
+// ReadExpansion is used when the Vaus is connected to the expansion port of Famicom.
+func (v *Vaus) ReadExpansion(port int) byte{
+	if port == Port1 {
+		return v.button() << 1
+	}
+	return v.shift() << 1
+}
@@ -0,0 +1,89 @@
+package nes
+
+const (
+	// zapperRadius is the radius in pixels which the photodiode of the zapper sees.
+	zapperRadius = 3
+	// zapperLightLines is how many lines the photodiode keeps sensing the light after the beam passes.
+	zapperLightLines = 20
+	// zapperBrightness is the minimum brightness (0 - 255) which the photodiode senses.
+	zapperBrightness = 0x55
+)
+
+// Zapper is the light gun, which is usually connected to port 2.
+// It senses the light of the pixels around the aimed position, which the ppu has just drawn.
+type Zapper struct {
+	x, y        int // aimed position on the screen, negative when it is off the screen
+	isTriggered bool
+	ppu         *Ppu
+}
+
+func NewZapper() *Zapper{
+	return &Zapper{
+		x: -1,
+		y: -1,
+	}
+}
+
+// Aim points the zapper at (x, y) of the 256x240 screen.
+// Any position outside of the screen aims off the screen.
+func (z *Zapper) Aim(x, y int){
+	z.x = x
+	z.y = y
+}
+
+// Pull pulls or releases the trigger.
+func (z *Zapper) Pull(isTriggered bool){
+	z.isTriggered = isTriggered
+}
+
+func (z *Zapper) attachPpu(p *Ppu){
+	z.ppu = p
+}
+
+func (z *Zapper) Write(b byte){
+	// the zapper has no input
+}
+
+// Read returns the light sense in bit 3 (0: light detected) and the trigger in bit 4 (1: pulled).
+func (z *Zapper) Read() byte{
+	b := byte(0x08)
+	if z.isLightSensed() {
+		b = 0x00
+	}
+	if z.isTriggered {
+		b |= 0x10
+	}
+	return b
+}
+
+func (z *Zapper) isOnScreen() bool{
+	return z.x >= 0 && z.x < 256 && z.y >= 0 && z.y < 240
+}
+
+// isLightSensed reports whether a bright pixel around the aimed position
+// has been drawn in the last zapperLightLines lines of the current frame.
+func (z *Zapper) isLightSensed() bool{
+	if z.ppu == nil || !z.isOnScreen() {
+		return false
+	}
+
+	line, dot := z.ppu.line, z.ppu.cycle
+	for y := z.y - zapperRadius; y <= z.y + zapperRadius; y++ {
+		if y < 0 || y >= 240 || y > line || line - y > zapperLightLines {
+			continue
+		}
+		for x := z.x - zapperRadius; x <= z.x + zapperRadius; x++ {
+			if x < 0 || x >= 256 {
+				continue
+			}
+			if y == line && x >= dot - 1 {
+				// not drawn yet
+				continue
+			}
+			if z.ppu.renderer.brightness(x, y) >= zapperBrightness {
+				return true
+			}
+		}
+	}
+	return false
+}
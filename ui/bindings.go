@@ -0,0 +1,395 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ad-sho-loko/goones/nes"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// buttonNames are the buttons of the standard controller in the order of nes.Nes.PushButton.
+var buttonNames = []string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right"}
+
+// turboPrefix makes the turbo button from the button name, e.g. "TurboA".
+const turboPrefix = "Turbo"
+
+// hotkeyNames are the actions which can be bound to keys.
+var hotkeyNames = []string{
+	"quit", "pause", "frame_advance", "slow_motion", "fast_forward",
+	"reset", "power_cycle", "screenshot", "macro_record", "macro_play", "movie_mode",
+}
+
+// portDevices are the devices which can be connected to the ports, by the same names as the options.
+var portDevices = map[string][]string{
+	"port1":     {"auto", "controller", "zapper", "vaus", "powerpad", "none"},
+	"port2":     {"auto", "controller", "zapper", "vaus", "powerpad", "none"},
+	"4p":        {"auto", "fourscore", "famicom", "none"},
+	"expansion": {"auto", "keyboard", "vaus", "none"},
+}
+
+// bindingsFile is the json in the bindings file. Each binding has one or more key names, e.g.
+//
+//	{
+//	  "controllers": {"1": {"A": ["A", "Space"], "TurboA": ["S"], "Start": ["Enter"]}},
+//	  "turbo": {"on": 2, "off": 2},
+//	  "powerpad": {"1": ["1"]},
+//	  "hotkeys": {"quit": ["Escape"]},
+//	  "gamepads": [{"joystick": 1, "player": 1, "deadzone": 0.3, "buttons": {"A": ["Button0"], "Up": ["Axis1-"]}}],
+//	  "ports": {"port2": "zapper", "expansion": "keyboard"}
+//	}
+//
+// Controllers "1" - "4" are the players on port 1, port 2 and the four player adapter.
+// "Turbo" + a button name is the turbo button, which toggles the button at the turbo rate in frames.
+// Bindings which are not in the file keep the defaults, and "gamepads" replaces all default gamepads.
+// "ports" are the devices of the options -port1, -port2, -4p and -expansion, which override them.
+type bindingsFile struct {
+	Controllers map[string]map[string][]string `json:"controllers"`
+	PowerPad    map[string][]string            `json:"powerpad"`
+	Hotkeys     map[string][]string            `json:"hotkeys"`
+	Gamepads    []gamepadFile                  `json:"gamepads"`
+	Ports       map[string]string              `json:"ports"`
+	Turbo       *turboFile                     `json:"turbo"`
+}
+
+type turboFile struct {
+	On  int `json:"on"`
+	Off int `json:"off"`
+}
+
+var defaultBindings = bindingsFile{
+	Controllers: map[string]map[string][]string{
+		"1": {
+			"A": {"A"}, "B": {"B"}, "Select": {"RightShift"}, "Start": {"Enter"},
+			"Up": {"Up"}, "Down": {"Down"}, "Left": {"Left"}, "Right": {"Right"},
+			"TurboA": {"S"}, "TurboB": {"X"},
+		},
+		"2": {
+			"A": {"M"}, "B": {"N"}, "Select": {"G"}, "Start": {"H"},
+			"Up": {"I"}, "Down": {"K"}, "Left": {"J"}, "Right": {"L"},
+		},
+		"3": {
+			"A": {"KP3"}, "B": {"KP1"}, "Select": {"KP7"}, "Start": {"KP9"},
+			"Up": {"KP8"}, "Down": {"KP5"}, "Left": {"KP4"}, "Right": {"KP6"},
+		},
+		"4": {
+			"A": {"PageUp"}, "B": {"Insert"}, "Select": {"Backspace"}, "Start": {"Backslash"},
+			"Up": {"Home"}, "Down": {"End"}, "Left": {"Delete"}, "Right": {"PageDown"},
+		},
+	},
+	// the number row in the order of the mat, which is free from the controllers and the hotkeys
+	PowerPad: map[string][]string{
+		"1": {"1"}, "2": {"2"}, "3": {"3"}, "4": {"4"},
+		"5": {"5"}, "6": {"6"}, "7": {"7"}, "8": {"8"},
+		"9": {"9"}, "10": {"0"}, "11": {"Minus"}, "12": {"Equal"},
+	},
+	Hotkeys: map[string][]string{
+		"quit":          {"Escape"},
+		"pause":         {"P", "Pause"},
+		"frame_advance": {"O"},
+		"slow_motion":   {"U"},
+		"fast_forward":  {"GraveAccent"},
+		"reset":         {"F5"},
+		"power_cycle":   {"F6"},
+		"screenshot":    {"F12"},
+		"macro_record":  {"F9"},
+		"macro_play":    {"F10"},
+		"movie_mode":    {"F11"},
+	},
+	Gamepads: []gamepadFile{
+		{Joystick: 1, Player: 1},
+		{Joystick: 2, Player: 2},
+		{Joystick: 3, Player: 3},
+		{Joystick: 4, Player: 4},
+	},
+	Turbo: &turboFile{On: nes.DefaultTurboOn, Off: nes.DefaultTurboOff},
+}
+
+// Bindings maps the keys to the buttons of the controllers, the power pad and the hotkeys,
+// and has the devices of the ports.
+type Bindings struct {
+	controllers [4][8][]glfw.Key
+	turbo       [4][8][]glfw.Key
+	turboOn     int
+	turboOff    int
+	powerPad    [12][]glfw.Key
+	hotkeys     map[string][]glfw.Key
+	gamepads    []*gamepadBinding
+	ports       map[string]string
+}
+
+// DefaultBindingsPath returns the bindings file in the user config dir, e.g. ~/.config/goones/bindings.json.
+func DefaultBindingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goones", "bindings.json"), nil
+}
+
+// LoadBindings reads the bindings file over the defaults.
+// A missing file is not an error, and the defaults are used.
+// All unknown names and the keys which are bound twice are reported at once.
+func LoadBindings(path string) (*Bindings, error) {
+	b := &Bindings{}
+	b.apply(defaultBindings)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f bindingsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	errs := b.apply(f)
+	if len(errs) == 0 {
+		errs = b.duplicates()
+	}
+	if len(errs) != 0 {
+		msg := fmt.Sprintf("%s: invalid bindings", path)
+		for _, err := range errs {
+			msg += "\n  " + err.Error()
+		}
+		return nil, errors.New(msg)
+	}
+	return b, nil
+}
+
+func (b *Bindings) apply(f bindingsFile) []error {
+	var errs []error
+
+	for player, buttons := range f.Controllers {
+		i, err := strconv.Atoi(player)
+		if err != nil || i < 1 || i > 4 {
+			errs = append(errs, fmt.Errorf("controller %q: unknown controller (1 - 4)", player))
+			continue
+		}
+		for button, names := range buttons {
+			j, isTurbo := parseButton(button)
+			if j < 0 {
+				errs = append(errs, fmt.Errorf("controller %s: unknown button %q (%s, or Turbo + them)",
+					player, button, strings.Join(buttonNames, ", ")))
+				continue
+			}
+			keys, err := parseKeys(names)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("controller %s button %s: %v", player, button, err))
+				continue
+			}
+			if isTurbo {
+				b.turbo[i - 1][j] = keys
+			} else {
+				b.controllers[i - 1][j] = keys
+			}
+		}
+	}
+
+	for button, names := range f.PowerPad {
+		i, err := strconv.Atoi(button)
+		if err != nil || i < 1 || i > 12 {
+			errs = append(errs, fmt.Errorf("powerpad: unknown button %q (1 - 12)", button))
+			continue
+		}
+		keys, err := parseKeys(names)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("powerpad button %s: %v", button, err))
+			continue
+		}
+		b.powerPad[i - 1] = keys
+	}
+
+	for hotkey, names := range f.Hotkeys {
+		if indexOf(hotkeyNames, hotkey) < 0 {
+			errs = append(errs, fmt.Errorf("unknown hotkey %q (%s)", hotkey, strings.Join(hotkeyNames, ", ")))
+			continue
+		}
+		keys, err := parseKeys(names)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("hotkey %s: %v", hotkey, err))
+			continue
+		}
+		if b.hotkeys == nil {
+			b.hotkeys = map[string][]glfw.Key{}
+		}
+		b.hotkeys[hotkey] = keys
+	}
+
+	if f.Gamepads != nil {
+		b.gamepads = nil
+		for i, g := range f.Gamepads {
+			gamepad, err := parseGamepad(g)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("gamepad #%d: %v", i + 1, err))
+				continue
+			}
+			b.gamepads = append(b.gamepads, gamepad)
+		}
+	}
+
+	if f.Turbo != nil {
+		if f.Turbo.On < 1 || f.Turbo.Off < 1 {
+			errs = append(errs, fmt.Errorf("turbo: on and off must be 1 frame or more"))
+		} else {
+			b.turboOn = f.Turbo.On
+			b.turboOff = f.Turbo.Off
+		}
+	}
+
+	for port, name := range f.Ports {
+		devices, ok := portDevices[port]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown port %q (port1, port2, 4p or expansion)", port))
+			continue
+		}
+		if indexOf(devices, name) < 0 {
+			errs = append(errs, fmt.Errorf("port %s: unknown device %q (%s)", port, name, strings.Join(devices, ", ")))
+			continue
+		}
+		if b.ports == nil {
+			b.ports = map[string]string{}
+		}
+		b.ports[port] = name
+	}
+
+	// maps are iterated in random order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// duplicates reports the keys which are bound to more than one button or hotkey.
+func (b *Bindings) duplicates() []error {
+	var errs []error
+	owners := map[glfw.Key]string{}
+	bind := func(owner string, keys []glfw.Key) {
+		for _, k := range keys {
+			if o, ok := owners[k]; ok && o != owner {
+				errs = append(errs, fmt.Errorf("key %q is bound to both %s and %s", keyName(k), o, owner))
+				continue
+			}
+			owners[k] = owner
+		}
+	}
+
+	for i := range b.controllers {
+		for j, name := range buttonNames {
+			bind(fmt.Sprintf("controller %d %s", i + 1, name), b.controllers[i][j])
+			bind(fmt.Sprintf("controller %d %s%s", i + 1, turboPrefix, name), b.turbo[i][j])
+		}
+	}
+	for i, keys := range b.powerPad {
+		bind(fmt.Sprintf("powerpad %d", i + 1), keys)
+	}
+	for _, name := range hotkeyNames {
+		bind("hotkey " + name, b.hotkeys[name])
+	}
+	return errs
+}
+
+// Ports returns the devices of the ports in the bindings file, e.g. "zapper" of "port2".
+// The ports which are not in the file are absent.
+func (b *Bindings) Ports() map[string]string {
+	ports := map[string]string{}
+	for port, name := range b.ports {
+		ports[port] = name
+	}
+	return ports
+}
+
+// parseButton returns the index of the button, and whether it is the turbo button.
+// The index is -1 if the button is unknown.
+func parseButton(name string) (int, bool) {
+	if i := indexOf(buttonNames, name); i >= 0 {
+		return i, false
+	}
+	if strings.HasPrefix(name, turboPrefix) {
+		return indexOf(buttonNames, strings.TrimPrefix(name, turboPrefix)), true
+	}
+	return -1, false
+}
+
+func parseKeys(names []string) ([]glfw.Key, error) {
+	var keys []glfw.Key
+	var unknowns []string
+	for _, name := range names {
+		k, ok := parseKey(name)
+		if !ok {
+			unknowns = append(unknowns, fmt.Sprintf("%q", name))
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(unknowns) != 0 {
+		return nil, fmt.Errorf("unknown key %s", strings.Join(unknowns, ", "))
+	}
+	return keys, nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsKey(keys []glfw.Key, key glfw.Key) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// isPressed reports whether any of the keys is pressed.
+func isPressed(pressed map[glfw.Key]bool, keys []glfw.Key) bool {
+	for _, k := range keys {
+		if pressed[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// buttons returns the buttons and the turbo buttons of the player (0 - 3) from the pressed keys.
+func (b *Bindings) buttons(player int, pressed map[glfw.Key]bool) ([8]bool, [8]bool) {
+	var buttons, turbo [8]bool
+	for i, keys := range b.controllers[player] {
+		buttons[i] = isPressed(pressed, keys)
+	}
+	for i, keys := range b.turbo[player] {
+		turbo[i] = isPressed(pressed, keys)
+	}
+	return buttons, turbo
+}
+
+// powerPadButtons returns the buttons 1 - 12 of the power pad from the pressed keys.
+func (b *Bindings) powerPadButtons(pressed map[glfw.Key]bool) [12]bool {
+	var buttons [12]bool
+	for i, keys := range b.powerPad {
+		buttons[i] = isPressed(pressed, keys)
+	}
+	return buttons
+}
+
+// hotkey returns the hotkey which is bound to the key.
+func (b *Bindings) hotkey(key glfw.Key) (string, bool) {
+	for _, name := range hotkeyNames {
+		if containsKey(b.hotkeys[name], key) {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestBindings loads the json as the bindings file.
+func loadTestBindings(t *testing.T, json string) (*Bindings, error) {
+	dir, err := ioutil.TempDir("", "goones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bindings.json")
+	if err := ioutil.WriteFile(path, []byte(json), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadBindings(path)
+}
+
+func TestDefaultBindings(t *testing.T) {
+	b := &Bindings{}
+	for _, err := range b.apply(defaultBindings) {
+		t.Error(err)
+	}
+	for _, err := range b.duplicates() {
+		t.Error(err)
+	}
+}
+
+func TestMissingBindingsFile(t *testing.T) {
+	b, err := LoadBindings(filepath.Join(os.TempDir(), "goones-missing", "bindings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := b.controllers[0][0]; len(keys) != 1 || keys[0] != glfw.KeyA {
+		t.Errorf("controller 1 A is %v, want the default A", keys)
+	}
+}
+
+func TestMultipleKeysPerButton(t *testing.T) {
+	b, err := loadTestBindings(t, `{"controllers": {"1": {"A": ["V", "Space"]}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []glfw.Key{glfw.KeyV, glfw.KeySpace} {
+		if buttons, _ := b.buttons(0, map[glfw.Key]bool{key: true}); !buttons[0] {
+			t.Errorf("key %s does not push controller 1 A", keyName(key))
+		}
+	}
+	if buttons, _ := b.buttons(0, map[glfw.Key]bool{glfw.KeyA: true}); buttons[0] {
+		t.Error("the default key A still pushes controller 1 A")
+	}
+	// the others keep the defaults
+	if buttons, _ := b.buttons(0, map[glfw.Key]bool{glfw.KeyB: true}); !buttons[1] {
+		t.Error("the default key B does not push controller 1 B")
+	}
+}
+
+func TestUnknownNames(t *testing.T) {
+	_, err := loadTestBindings(t, `{
+		"controllers": {"1": {"A": ["NoSuchKey"], "C": ["X"]}, "5": {"A": ["Y"]}},
+		"powerpad": {"13": ["Q"]},
+		"hotkeys": {"jump": ["F1"]},
+		"ports": {"port3": "zapper", "port2": "mouse"}
+	}`)
+	if err == nil {
+		t.Fatal("unknown names are not reported")
+	}
+
+	for _, want := range []string{
+		`controller 1 button A: unknown key "NoSuchKey"`,
+		`controller 1: unknown button "C"`,
+		`controller "5": unknown controller`,
+		`powerpad: unknown button "13"`,
+		`unknown hotkey "jump"`,
+		`unknown port "port3"`,
+		`port port2: unknown device "mouse"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q is not reported in:\n%v", want, err)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{
+			"controllers",
+			`{"controllers": {"2": {"A": ["Enter"]}}}`,
+			`key "Enter" is bound to both controller 1 Start and controller 2 A`,
+		},
+		{
+			"powerpad and hotkey",
+			`{"hotkeys": {"quit": ["1"]}}`,
+			`key "1" is bound to both powerpad 1 and hotkey quit`,
+		},
+		{
+			"twice in a button",
+			`{"controllers": {"1": {"A": ["V", "V"]}}}`,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		_, err := loadTestBindings(t, tt.json)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPorts(t *testing.T) {
+	b, err := loadTestBindings(t, `{"ports": {"port2": "zapper", "expansion": "keyboard"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ports := b.Ports()
+	if len(ports) != 2 || ports["port2"] != "zapper" || ports["expansion"] != "keyboard" {
+		t.Errorf("ports %v, want port2 zapper and expansion keyboard", ports)
+	}
+}
@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"github.com/ad-sho-loko/goones/nes"
+	"github.com/go-gl/glfw/v3.2/glfw"
+)
+
+// familyKeys maps the keys to the keys of the family keyboard.
+// Letters, digits and F1 - F8 are mapped to the same keys.
+var familyKeys = map[glfw.Key]string{
+	glfw.KeyEnter:        "RETURN",
+	glfw.KeyTab:          "ESC",
+	glfw.KeyLeftControl:  "CTR",
+	glfw.KeyLeftShift:    "LSHIFT",
+	glfw.KeyRightShift:   "RSHIFT",
+	glfw.KeyLeftAlt:      "GRPH",
+	glfw.KeyRightAlt:     "KANA",
+	glfw.KeyEnd:          "STOP",
+	glfw.KeySpace:        "SPACE",
+	glfw.KeyHome:         "CLR",
+	glfw.KeyInsert:       "INS",
+	glfw.KeyDelete:       "DEL",
+	glfw.KeyBackspace:    "DEL",
+	glfw.KeyUp:           "UP",
+	glfw.KeyDown:         "DOWN",
+	glfw.KeyLeft:         "LEFT",
+	glfw.KeyRight:        "RIGHT",
+	glfw.KeyLeftBracket:  "[",
+	glfw.KeyRightBracket: "]",
+	glfw.KeySemicolon:    ";",
+	glfw.KeyApostrophe:   ":",
+	glfw.KeyGraveAccent:  "@",
+	glfw.KeyComma:        ",",
+	glfw.KeyPeriod:       ".",
+	glfw.KeySlash:        "/",
+	glfw.KeyMinus:        "-",
+	glfw.KeyEqual:        "^",
+	glfw.KeyBackslash:    "YEN",
+	glfw.KeyRightControl: "_",
+}
+
+func init() {
+	for k := glfw.KeyA; k <= glfw.KeyZ; k++ {
+		familyKeys[k] = string('A' + rune(k - glfw.KeyA))
+	}
+	for k := glfw.Key0; k <= glfw.Key9; k++ {
+		familyKeys[k] = string('0' + rune(k - glfw.Key0))
+	}
+	for k := glfw.KeyF1; k <= glfw.KeyF8; k++ {
+		familyKeys[k] = string('F') + string('1' + rune(k - glfw.KeyF1))
+	}
+}
+
+// pushDeviceKey passes the key to the family keyboard, which takes all keys of it
+// except the hotkeys before the controllers, and reports whether it is consumed.
+func (d *Director) pushDeviceKey(key glfw.Key, isPush bool) bool {
+	k, ok := d.nes.ExpansionDevice().(*nes.FamilyKeyboard)
+	if !ok {
+		return false
+	}
+	name, ok := familyKeys[key]
+	if !ok {
+		return false
+	}
+	k.PushKey(name, isPush)
+	return true
+}
+
+// updateDevices feeds the mouse to the devices every frame.
+func (d *Director) updateDevices() {
+	x, y := cursorPosition(d.window)
+	isLeftPressed := d.window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press
+	isRightPressed := d.window.GetMouseButton(glfw.MouseButtonRight) == glfw.Press
+
+	devices := []interface{}{d.nes.ExpansionDevice()}
+	for _, port := range []int{nes.Port1, nes.Port2} {
+		devices = append(devices, d.nes.InputDevice(port))
+	}
+
+	for _, device := range devices {
+		switch device := device.(type) {
+		case *nes.Zapper:
+			// The left button pulls the trigger, and the right button pulls it
+			// aiming off the screen, e.g. to reload.
+			if isRightPressed {
+				device.Aim(-1, -1)
+				device.Pull(true)
+				continue
+			}
+			device.Aim(x, y)
+			device.Pull(isLeftPressed)
+		case *nes.Vaus:
+			// The paddle follows the mouse, and the left button pushes the button.
+			device.Move(x)
+			device.Push(isLeftPressed)
+		}
+	}
+}
@@ -1,25 +1,174 @@
 package ui
 
 import (
+	"fmt"
 	"github.com/ad-sho-loko/goones/nes"
 	"github.com/go-gl/gl/v2.1/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
+	"log"
 )
 
 type Director struct {
 	nes *nes.Nes
 	window *glfw.Window
 	gameView View
+	bindings *Bindings
+	pressed map[glfw.Key]bool
+	pressedHotkeys map[glfw.Key]bool
+	hotkeys map[string]func()
+	gamepadButtons [4][8]bool
+	gamepadTurbo [4][8]bool
+	macro nes.Macro // recorded for player 1
+	isDesyncReported bool
+	isPaused bool
+	isAdvancing bool // run a frame while paused
+	speed float64 // frames per refresh of the window
+	frames float64 // frames to run, which are accumulated by speed
+	fastForward float64 // speed while fast_forward is held
+	pacer *pacer
+	options Options
+	joysticks map[glfw.Joystick]bool // joysticks which are connected
 }
 
-func newDirector(nes *nes.Nes, window *glfw.Window) *Director {
-	return &Director{
+func newDirector(nes *nes.Nes, window *glfw.Window, bindings *Bindings, options Options) *Director {
+	d := &Director{
 		nes:nes,
 		window:window,
+		bindings:bindings,
+		pressed:map[glfw.Key]bool{},
+		pressedHotkeys:map[glfw.Key]bool{},
+		joysticks:map[glfw.Joystick]bool{},
+		speed:1,
+		fastForward:options.FastForward,
+		pacer:newPacer(nes.Region().FrameRate(), options.IsUncapped),
+		options:options,
+	}
+	d.hotkeys = map[string]func(){
+		"quit":          func() { d.window.SetShouldClose(true) },
+		"pause":         d.togglePause,
+		"frame_advance": d.advanceFrame,
+		"slow_motion":   d.toggleSlowMotion,
+		"reset":         d.nes.Reset,
+		"power_cycle":   d.nes.PowerCycle,
+		"screenshot":    d.saveScreenshot,
+		"macro_record":  d.toggleMacroRecording,
+		"macro_play":    func() { d.nes.PlayMacro(0, d.macro) },
+		"movie_mode":    d.toggleMovieMode,
+	}
+	return d
+}
+
+// slowSpeeds are the speeds which slow_motion goes through.
+var slowSpeeds = []float64{1, 0.5, 0.25}
+
+func (d *Director) togglePause(){
+	d.isPaused = !d.isPaused
+	d.updateTitle()
+}
+
+// advanceFrame runs a frame and pauses.
+func (d *Director) advanceFrame(){
+	d.isPaused = true
+	d.isAdvancing = true
+	d.updateTitle()
+}
+
+func (d *Director) toggleSlowMotion(){
+	i := 0
+	for j, speed := range slowSpeeds {
+		if speed == d.speed {
+			i = (j + 1) % len(slowSpeeds)
+		}
+	}
+	d.speed = slowSpeeds[i]
+	d.frames = 0
+	d.updateTitle()
+}
+
+// isFastForward reports whether any key of fast_forward is held.
+func (d *Director) isFastForward() bool{
+	return isPressed(d.pressedHotkeys, d.bindings.hotkeys["fast_forward"])
+}
+
+func (d *Director) updateTitle(){
+	t := title
+	if d.isPaused {
+		t += " - paused"
+	} else if d.isFastForward() {
+		t += fmt.Sprintf(" - x%g", d.fastForward)
+	} else if d.speed != 1 {
+		t += fmt.Sprintf(" - x%g", d.speed)
+	}
+	if d.pacer.isUncapped {
+		t += fmt.Sprintf(" - uncapped %.0f fps", d.pacer.fps)
+	}
+	d.window.SetTitle(t)
+}
+
+// framesToRun returns how many frames are run in this refresh of the window.
+// The window keeps being refreshed even while it is paused.
+func (d *Director) framesToRun() int{
+	n := 0
+	if !d.isPaused {
+		speed := d.speed
+		if d.isFastForward() {
+			speed = d.fastForward
+		}
+		d.frames += speed
+		n = int(d.frames)
+		d.frames -= float64(n)
+	} else if d.isAdvancing {
+		d.isAdvancing = false
+		n = 1
+	}
+
+	if d.pacer.count(n) && d.pacer.isUncapped {
+		d.updateTitle()
+	}
+	return n
+}
+
+func (d *Director) saveScreenshot(){
+	path, err := d.nes.SaveScreenshot(d.options.ScreenshotDir, d.options.RomName, d.options.Screenshot)
+	if err != nil {
+		log.Printf("screenshot: %v", err)
+		return
+	}
+	log.Printf("screenshot: %s", path)
+}
+
+// toggleMacroRecording starts or stops recording the macro of player 1.
+func (d *Director) toggleMacroRecording(){
+	if d.nes.IsRecordingMacro(0) {
+		d.macro = d.nes.StopMacroRecording(0)
+		log.Printf("macro recorded: %d frames", len(d.macro))
+		return
+	}
+	d.nes.StartMacroRecording(0)
+	log.Printf("recording macro")
+}
+
+// toggleMovieMode switches the playing movie between read-only and read-write.
+func (d *Director) toggleMovieMode(){
+	if !d.nes.IsMoviePlaying() {
+		return
+	}
+	if d.nes.MovieMode() == nes.MovieReadOnly {
+		d.nes.SetMovieMode(nes.MovieReadWrite)
+		log.Printf("movie: read-write")
+	} else {
+		d.nes.SetMovieMode(nes.MovieReadOnly)
+		log.Printf("movie: read-only")
 	}
 }
 
-var keyStates [8]bool
+// reportMovieDesync logs the first frame where the movie is desynced.
+func (d *Director) reportMovieDesync(){
+	if frame, ok := d.nes.MovieDesync(); ok && !d.isDesyncReported {
+		log.Printf("movie desynced at frame %d", frame)
+		d.isDesyncReported = true
+	}
+}
 
 func (d *Director) setKeyCallback(){
 	callback := func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey){
@@ -28,39 +177,66 @@ func (d *Director) setKeyCallback(){
 		}
 		var isPush = action == glfw.Press
 
-		switch key {
-		case glfw.KeyA:
-			keyStates[0] = isPush
-		case glfw.KeyB:
-			keyStates[1] = isPush
-		case glfw.KeyRightShift :
-			keyStates[2] = isPush
-		case glfw.KeyEnter :
-			keyStates[3] = isPush
-		case glfw.KeyUp :
-			keyStates[4] = isPush
-		case glfw.KeyDown :
-			keyStates[5] = isPush
-		case glfw.KeyLeft :
-			keyStates[6] = isPush
-		case glfw.KeyRight :
-			keyStates[7] = isPush
+		// the hotkeys take their keys before the family keyboard, so it can always be quit or paused.
+		if hotkey, ok := d.bindings.hotkey(key); ok {
+			d.pressedHotkeys[key] = isPush
+			if hotkey == "fast_forward" {
+				// works while it is held
+				d.updateTitle()
+			} else if isPush {
+				d.hotkeys[hotkey]()
+			}
+			return
+		}
+
+		if d.pushDeviceKey(key, isPush) {
+			return
 		}
-		d.nes.PushButton(keyStates)
+
+		d.pressed[key] = isPush
+		d.updateButtons()
 	}
 	d.window.SetKeyCallback(callback)
 }
 
+// updateButtons pushes the buttons of the controllers and the power pad from the pressed keys and the gamepads.
+func (d *Director) updateButtons(){
+	for player := 0; player < 4; player++ {
+		b, turbo := d.bindings.buttons(player, d.pressed)
+		for i := range b {
+			b[i] = b[i] || d.gamepadButtons[player][i]
+			turbo[i] = turbo[i] || d.gamepadTurbo[player][i]
+		}
+		d.nes.PushButton(player, b)
+		d.nes.PushTurbo(player, turbo)
+	}
+	for _, port := range []int{nes.Port1, nes.Port2} {
+		if p, ok := d.nes.InputDevice(port).(*nes.PowerPad); ok {
+			p.SetButton(d.bindings.powerPadButtons(d.pressed))
+		}
+	}
+}
+
 func (d *Director) start(){
 	d.nes.Init()
+	for player := 0; player < 4; player++ {
+		for button := 0; button < 8; button++ {
+			d.nes.SetTurboRate(player, button, d.bindings.turboOn, d.bindings.turboOff)
+		}
+	}
 	d.setKeyCallback()
 	d.playGame()
 
-	// main loop
+	d.updateTitle()
+
+	// main loop, paced by the refresh rate of the console
 	for !d.window.ShouldClose() {
 		d.update()
 		d.window.SwapBuffers()
 		glfw.PollEvents()
+		d.pollGamepads()
+		d.updateButtons()
+		d.pacer.wait()
 	}
 
 	d.setView(nil)
@@ -73,7 +249,9 @@ func (d *Director) playGame(){
 
 func (d *Director) update(){
 	gl.Clear(gl.COLOR_BUFFER_BIT)
+	d.updateDevices()
 	d.gameView.Update()
+	d.reportMovieDesync()
 }
 
 func (d *Director) setView(view View){
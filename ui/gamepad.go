@@ -0,0 +1,175 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultDeadzone is how far an axis must be tilted to push the button (0 - 1).
+const defaultDeadzone = 0.3
+
+// defaultGamepadButtons fits the usual layout of xinput pads;
+// the left stick and the d-pad, which appears as axes 6 and 7 on linux.
+var defaultGamepadButtons = map[string][]string{
+	"A":      {"Button0"},
+	"B":      {"Button2"},
+	"Select": {"Button6"},
+	"Start":  {"Button7"},
+	"Up":     {"Axis1-", "Axis7-"},
+	"Down":   {"Axis1+", "Axis7+"},
+	"Left":   {"Axis0-", "Axis6-"},
+	"Right":  {"Axis0+", "Axis6+"},
+	"TurboA": {"Button1"},
+	"TurboB": {"Button3"},
+}
+
+// gamepadFile is a gamepad in the bindings file.
+// Inputs are "Button<n>" or "Axis<n>+" / "Axis<n>-". Hats are buttons after the others in glfw 3.2.
+type gamepadFile struct {
+	Joystick int                 `json:"joystick"` // 1 - 16
+	Player   int                 `json:"player"`   // 1 - 4
+	Deadzone *float32            `json:"deadzone"`
+	Buttons  map[string][]string `json:"buttons"`
+}
+
+type gamepadInput struct {
+	isAxis bool
+	index  int
+	sign   float32 // direction of the axis
+}
+
+type gamepadBinding struct {
+	joystick glfw.Joystick
+	player   int
+	deadzone float32
+	buttons  [8][]gamepadInput
+	turbo    [8][]gamepadInput
+}
+
+var gamepadInputPattern = regexp.MustCompile(`^(?i)(button|axis)(\d+)([+-]?)$`)
+
+func parseGamepadInput(name string) (gamepadInput, bool) {
+	m := gamepadInputPattern.FindStringSubmatch(name)
+	if m == nil {
+		return gamepadInput{}, false
+	}
+	index, _ := strconv.Atoi(m[2])
+	if strings.EqualFold(m[1], "button") {
+		return gamepadInput{index: index}, m[3] == ""
+	}
+
+	if m[3] == "" {
+		return gamepadInput{}, false
+	}
+	sign := float32(1)
+	if m[3] == "-" {
+		sign = -1
+	}
+	return gamepadInput{isAxis: true, index: index, sign: sign}, true
+}
+
+func parseGamepad(f gamepadFile) (*gamepadBinding, error) {
+	if f.Joystick < 1 || f.Joystick > int(glfw.JoystickLast - glfw.Joystick1) + 1 {
+		return nil, fmt.Errorf("unknown joystick %d (1 - %d)", f.Joystick, glfw.JoystickLast - glfw.Joystick1 + 1)
+	}
+	if f.Player < 1 || f.Player > 4 {
+		return nil, fmt.Errorf("unknown player %d (1 - 4)", f.Player)
+	}
+
+	g := &gamepadBinding{
+		joystick: glfw.Joystick1 + glfw.Joystick(f.Joystick - 1),
+		player:   f.Player - 1,
+		deadzone: defaultDeadzone,
+	}
+	if f.Deadzone != nil {
+		g.deadzone = *f.Deadzone
+	}
+
+	buttons := map[string][]string{}
+	for button, names := range defaultGamepadButtons {
+		buttons[button] = names
+	}
+	for button, names := range f.Buttons {
+		buttons[button] = names
+	}
+
+	for button, names := range buttons {
+		i, isTurbo := parseButton(button)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown button %q (%s, or Turbo + them)", button, strings.Join(buttonNames, ", "))
+		}
+		var inputs []gamepadInput
+		for _, name := range names {
+			input, ok := parseGamepadInput(name)
+			if !ok {
+				return nil, fmt.Errorf("button %s: unknown input %q (Button<n>, Axis<n>+ or Axis<n>-)", button, name)
+			}
+			inputs = append(inputs, input)
+		}
+		if isTurbo {
+			g.turbo[i] = inputs
+		} else {
+			g.buttons[i] = inputs
+		}
+	}
+	return g, nil
+}
+
+func (g *gamepadBinding) isPressed(input gamepadInput, axes []float32, buttons []byte) bool {
+	if input.isAxis {
+		return input.index < len(axes) && axes[input.index] * input.sign > g.deadzone
+	}
+	return input.index < len(buttons) && glfw.Action(buttons[input.index]) == glfw.Press
+}
+
+func (g *gamepadBinding) isAnyPressed(inputs []gamepadInput, axes []float32, buttons []byte) bool {
+	for _, input := range inputs {
+		if g.isPressed(input, axes, buttons) {
+			return true
+		}
+	}
+	return false
+}
+
+// poll reads the buttons and the turbo buttons of the gamepad. ok is false when it is not connected.
+func (g *gamepadBinding) poll() (b [8]bool, turbo [8]bool, ok bool) {
+	if !glfw.JoystickPresent(g.joystick) {
+		return b, turbo, false
+	}
+
+	axes := glfw.GetJoystickAxes(g.joystick)
+	buttons := glfw.GetJoystickButtons(g.joystick)
+	for i := range b {
+		b[i] = g.isAnyPressed(g.buttons[i], axes, buttons)
+		turbo[i] = g.isAnyPressed(g.turbo[i], axes, buttons)
+	}
+	return b, turbo, true
+}
+
+// pollGamepads reads the gamepads every frame, which can be plugged and unplugged at any time.
+func (d *Director) pollGamepads() {
+	d.gamepadButtons = [4][8]bool{}
+	d.gamepadTurbo = [4][8]bool{}
+	for _, g := range d.bindings.gamepads {
+		b, turbo, ok := g.poll()
+		if ok != d.joysticks[g.joystick] {
+			if ok {
+				log.Printf("gamepad connected: %s (player %d)", glfw.GetJoystickName(g.joystick), g.player + 1)
+			} else {
+				log.Printf("gamepad disconnected (player %d)", g.player + 1)
+			}
+			d.joysticks[g.joystick] = ok
+		}
+		if !ok {
+			continue
+		}
+		for i := range b {
+			d.gamepadButtons[g.player][i] = d.gamepadButtons[g.player][i] || b[i]
+			d.gamepadTurbo[g.player][i] = d.gamepadTurbo[g.player][i] || turbo[i]
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"strings"
+)
+
+// keyNames are the names of the keys in the bindings file.
+// Letters, digits and function keys are added in init.
+var keyNames = map[string]glfw.Key{
+	"Space":        glfw.KeySpace,
+	"Apostrophe":   glfw.KeyApostrophe,
+	"Comma":        glfw.KeyComma,
+	"Minus":        glfw.KeyMinus,
+	"Period":       glfw.KeyPeriod,
+	"Slash":        glfw.KeySlash,
+	"Semicolon":    glfw.KeySemicolon,
+	"Equal":        glfw.KeyEqual,
+	"LeftBracket":  glfw.KeyLeftBracket,
+	"Backslash":    glfw.KeyBackslash,
+	"RightBracket": glfw.KeyRightBracket,
+	"GraveAccent":  glfw.KeyGraveAccent,
+	"Escape":       glfw.KeyEscape,
+	"Enter":        glfw.KeyEnter,
+	"Tab":          glfw.KeyTab,
+	"Backspace":    glfw.KeyBackspace,
+	"Insert":       glfw.KeyInsert,
+	"Delete":       glfw.KeyDelete,
+	"Right":        glfw.KeyRight,
+	"Left":         glfw.KeyLeft,
+	"Down":         glfw.KeyDown,
+	"Up":           glfw.KeyUp,
+	"PageUp":       glfw.KeyPageUp,
+	"PageDown":     glfw.KeyPageDown,
+	"Home":         glfw.KeyHome,
+	"End":          glfw.KeyEnd,
+	"CapsLock":     glfw.KeyCapsLock,
+	"ScrollLock":   glfw.KeyScrollLock,
+	"NumLock":      glfw.KeyNumLock,
+	"PrintScreen":  glfw.KeyPrintScreen,
+	"Pause":        glfw.KeyPause,
+	"KPDecimal":    glfw.KeyKPDecimal,
+	"KPDivide":     glfw.KeyKPDivide,
+	"KPMultiply":   glfw.KeyKPMultiply,
+	"KPSubtract":   glfw.KeyKPSubtract,
+	"KPAdd":        glfw.KeyKPAdd,
+	"KPEnter":      glfw.KeyKPEnter,
+	"KPEqual":      glfw.KeyKPEqual,
+	"LeftShift":    glfw.KeyLeftShift,
+	"LeftControl":  glfw.KeyLeftControl,
+	"LeftAlt":      glfw.KeyLeftAlt,
+	"LeftSuper":    glfw.KeyLeftSuper,
+	"RightShift":   glfw.KeyRightShift,
+	"RightControl": glfw.KeyRightControl,
+	"RightAlt":     glfw.KeyRightAlt,
+	"RightSuper":   glfw.KeyRightSuper,
+	"Menu":         glfw.KeyMenu,
+}
+
+func init() {
+	for k := glfw.KeyA; k <= glfw.KeyZ; k++ {
+		keyNames[string('A' + rune(k - glfw.KeyA))] = k
+	}
+	for k := glfw.Key0; k <= glfw.Key9; k++ {
+		keyNames[string('0' + rune(k - glfw.Key0))] = k
+	}
+	for k := glfw.KeyKP0; k <= glfw.KeyKP9; k++ {
+		keyNames[fmt.Sprintf("KP%d", k - glfw.KeyKP0)] = k
+	}
+	for k := glfw.KeyF1; k <= glfw.KeyF25; k++ {
+		keyNames[fmt.Sprintf("F%d", k - glfw.KeyF1 + 1)] = k
+	}
+}
+
+// parseKey finds the key by its name, ignoring the case.
+func parseKey(name string) (glfw.Key, bool) {
+	for n, k := range keyNames {
+		if strings.EqualFold(n, name) {
+			return k, true
+		}
+	}
+	return glfw.KeyUnknown, false
+}
+
+// keyName returns the name of the key in the bindings file.
+func keyName(key glfw.Key) string {
+	for n, k := range keyNames {
+		if k == key {
+			return n
+		}
+	}
+	return fmt.Sprintf("%d", key)
+}
@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"time"
+)
+
+// maxLag is how late the loop can be before the pacer stops catching up,
+// e.g. after the window is dragged or the machine wakes from sleep.
+const maxLag = 100 * time.Millisecond
+
+// pacer paces the main loop at the refresh rate of the console.
+// The deadline of each frame is advanced by the exact frame time instead of being set from now,
+// so the errors of sleeping and rendering are compensated by the next frames and don't drift.
+type pacer struct {
+	frameTime  time.Duration
+	next       time.Time
+	isUncapped bool // don't wait at all
+
+	fps      float64 // frames run in the last second
+	frames   int
+	fpsStart time.Time
+}
+
+func newPacer(frameRate float64, isUncapped bool) *pacer{
+	now := time.Now()
+	return &pacer{
+		frameTime:  time.Duration(float64(time.Second) / frameRate),
+		next:       now,
+		isUncapped: isUncapped,
+		fpsStart:   now,
+	}
+}
+
+// wait sleeps until the deadline of the next frame.
+func (p *pacer) wait(){
+	if p.isUncapped {
+		return
+	}
+
+	p.next = p.next.Add(p.frameTime)
+	wait := time.Until(p.next)
+	if wait > 0 {
+		time.Sleep(wait)
+	} else if -wait > maxLag {
+		p.next = time.Now()
+	}
+}
+
+// count adds the frames which are run, and reports whether fps is updated.
+func (p *pacer) count(frames int) bool{
+	p.frames += frames
+	elapsed := time.Since(p.fpsStart)
+	if elapsed < time.Second {
+		return false
+	}
+	p.fps = float64(p.frames) / elapsed.Seconds()
+	p.frames = 0
+	p.fpsStart = time.Now()
+	return true
+}
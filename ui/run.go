@@ -20,7 +20,19 @@ func init() {
 	runtime.LockOSThread()
 }
 
-func RunUi(n *nes.Nes){
+// DefaultFastForward is the speed while fast_forward is held.
+const DefaultFastForward = 4
+
+// Options are how the console is run in the window.
+type Options struct {
+	FastForward   float64 // speed while fast_forward is held
+	IsUncapped    bool    // run as fast as possible, e.g. for benchmarking
+	RomName       string  // for the names and the text chunks of screenshots
+	ScreenshotDir string
+	Screenshot    nes.ScreenshotOptions
+}
+
+func RunUi(n *nes.Nes, bindings *Bindings, options Options){
 	err := glfw.Init()
 	if err != nil {
 		panic(err)
@@ -34,6 +46,8 @@ func RunUi(n *nes.Nes){
 		panic(err)
 	}
 	window.MakeContextCurrent()
+	// frames are paced by the console, not by vsync of the monitor
+	glfw.SwapInterval(0)
 
 	// initialize gl
 	if err := gl.Init(); err != nil {
@@ -41,7 +55,7 @@ func RunUi(n *nes.Nes){
 	}
 	gl.Enable(gl.TEXTURE_2D)
 
-	d := newDirector(n, window)
+	d := newDirector(n, window, bindings, options)
 	d.start()
 }
 
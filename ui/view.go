@@ -29,7 +29,9 @@ func (g *GameView) Enter(){
 }
 
 func (g *GameView) Update(){
-	g.director.nes.Run()
+	for i := g.director.framesToRun(); i > 0; i-- {
+		g.director.nes.Run()
+	}
 	rgba := g.director.nes.Buffer()
 	gl.BindTexture(gl.TEXTURE_2D, g.texture)
 	setTexture(rgba)
@@ -56,8 +58,9 @@ func setTexture(i *image.RGBA) {
 		0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(i.Pix))
 }
 
-func drawBuffer(window *glfw.Window) {
-	w, h := window.GetFramebufferSize()
+// bufferSize returns the half size of the picture in the window, in normalized device coordinates.
+// The picture keeps its aspect ratio and is centered in the window.
+func bufferSize(w, h int) (float32, float32) {
 	s1 := float32(w) / 256
 	s2 := float32(h) / 240
 	f := float32(1)
@@ -69,6 +72,30 @@ func drawBuffer(window *glfw.Window) {
 		x = f
 		y = f * s1 / s2
 	}
+	return x, y
+}
+
+// cursorPosition returns the position of the mouse cursor on the 256x240 screen,
+// which is outside of the screen when the cursor is out of the picture.
+func cursorPosition(window *glfw.Window) (int, int) {
+	w, h := window.GetSize()
+	if w == 0 || h == 0 {
+		return -1, -1
+	}
+	cx, cy := window.GetCursorPos()
+	x, y := bufferSize(w, h)
+	nx := float32(cx) / float32(w) * 2 - 1
+	ny := float32(cy) / float32(h) * 2 - 1
+	u := (nx / x + 1) / 2 * 256
+	v := (ny / y + 1) / 2 * 240
+	if u < 0 || v < 0 {
+		return -1, -1
+	}
+	return int(u), int(v)
+}
+
+func drawBuffer(window *glfw.Window) {
+	x, y := bufferSize(window.GetFramebufferSize())
 	gl.Begin(gl.QUADS)
 	gl.TexCoord2f(0, 1)
 	gl.Vertex2f(-x, -y)